@@ -17,13 +17,9 @@
 package configlib
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
-	kJson "github.com/knadh/koanf/parsers/json"
-	"github.com/knadh/koanf/providers/file"
-	"github.com/knadh/koanf/v2"
-	"github.com/mitchellh/mapstructure"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -32,42 +28,19 @@ func validateJSONConfig(schema, jsonConfig []byte) error {
 	documentLoader := gojsonschema.NewBytesLoader(jsonConfig)
 	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
 	if err != nil {
-		return fmt.Errorf("error validating: %s", err.Error())
+		return markError(ErrInvalidSchema, fmt.Errorf("error validating: %w", err))
 	}
 	if !result.Valid() {
-		return fmt.Errorf("json schema validation errors: %s", result.Errors())
+		return newValidationError(result.Errors())
 	}
 	return nil
 }
 
 // GetConfigFromFile func read configuration from file and save in output interface.
+// The config file is searched in configPath as configName followed by one of the registered extensions
+// (see RegisterParser), and it is read with the parser registered for the found extension.
+// It is a shortcut for a Loader configured with WithFile and WithSchema.
 func GetConfigFromFile(configName, configPath string, jsonSchema []byte, output interface{}) error {
-	var k = koanf.New(".")
-
-	if err := k.Load(file.Provider(fmt.Sprintf("%s/%s.json", configPath, configName)), kJson.Parser()); err != nil {
-		return fmt.Errorf("error loading config file: %s", err.Error())
-	}
-
-	if jsonSchema != nil {
-		jsonDocument, err := json.Marshal(k.Raw())
-		if err != nil {
-			return fmt.Errorf("config document stringify failed: %s", err.Error())
-		}
-		err = validateJSONConfig(jsonSchema, jsonDocument)
-		if err != nil {
-			return fmt.Errorf("configuration not valid: %s", err.Error())
-		}
-	}
-
-	if err := k.UnmarshalWithConf("", &output, koanf.UnmarshalConf{
-		DecoderConfig: &mapstructure.DecoderConfig{
-			Metadata:         nil,
-			Result:           &output,
-			WeaklyTypedInput: true,
-			ErrorUnused:      true,
-		},
-	}); err != nil {
-		return fmt.Errorf("error unmarshalling file: %s", err.Error())
-	}
-	return nil
+	loader := NewLoader(WithFile(configName, configPath), WithSchema(jsonSchema))
+	return loader.Load(context.Background(), output)
 }
@@ -17,12 +17,13 @@
 package configlib
 
 import (
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"strings"
 	"testing"
 
-	"github.com/spf13/viper"
 	"gotest.tools/assert"
 )
 
@@ -77,20 +78,29 @@ func TestGetConfigFromFile(t *testing.T) {
 		})
 	})
 
+	t.Run("fill a map output passed by value", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		mapConfig := map[string]interface{}{}
+		err := GetConfigFromFile("config", dir, nil, mapConfig)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, mapConfig, map[string]interface{}{"name": "my-service", "port": float64(3000)})
+	})
+
 	t.Run("throw if config file not found at selected path", func(t *testing.T) {
 		wrongConfigPath := "./wrong-path"
 		err := GetConfigFromFile(configName, wrongConfigPath, nil, &config)
 		assert.Assert(t, err != nil, "Error is nil.")
-		_, ok := err.(viper.ConfigFileNotFoundError)
-		assert.Assert(t, !ok, "Expected error is file not found, but not returned.")
+		assert.Assert(t, errors.Is(err, ErrConfigNotFound), "Expected error is file not found, but not returned.")
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist), "Expected error is file not found, but not returned.")
 	})
 
 	t.Run("throw if config file not found with selected name", func(t *testing.T) {
 		wrongConfigName := "a wrong file name"
 		err := GetConfigFromFile(wrongConfigName, configPath, nil, &config)
 		assert.Assert(t, err != nil, "Error is nil.")
-		_, ok := err.(viper.ConfigFileNotFoundError)
-		assert.Assert(t, !ok, "Expected error is file not found, but not returned.")
+		assert.Assert(t, errors.Is(err, ErrConfigNotFound), "Expected error is file not found, but not returned.")
 	})
 
 	t.Run("throw if output struct does not contain config variable", func(t *testing.T) {
@@ -98,6 +108,7 @@ func TestGetConfigFromFile(t *testing.T) {
 		var wrongConfig MyConfigStructure
 		err := GetConfigFromFile(configName, configPath, nil, &wrongConfig)
 		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, errors.Is(err, ErrDecode), "Expected error is decode error, but not returned.")
 		assert.Equal(t, wrongConfig, MyConfigStructure{}, "Config is not empty.")
 	})
 }
@@ -160,8 +171,96 @@ func TestGetConfigFromFileWithJSONSchemaValidation(t *testing.T) {
 		}`)
 		err := GetConfigFromFile(configName, configPath, jsonSchema, &config)
 		assert.Assert(t, err != nil, "Error is not nil.")
+		assert.Assert(t, errors.Is(err, ErrValidation), "Expected error is validation error, but not returned.")
+		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), "Config file error.")
+	})
+}
+
+func TestGetConfigFromYAMLFile(t *testing.T) {
+	type SubConfiguration struct {
+		Kbool         bool                   `koanf:"kbool"`
+		Kstring       string                 `koanf:"kstring"`
+		Kint          int64                  `koanf:"kint"`
+		Kfloat        float64                `koanf:"kfloat"`
+		ArrayOfString []string               `koanf:"array-of-string"`
+		ArrayOfNumber []int64                `koanf:"array-of-number"`
+		Other         map[string]interface{} `koanf:"something"`
+	}
+
+	type Configuration map[string]SubConfiguration
+
+	configName := "test-config-yaml.test"
+	configPath := "."
+	defaults := SubConfiguration{
+		Kbool:         true,
+		Kstring:       "my-string",
+		Kint:          12,
+		Kfloat:        float64(13.50),
+		ArrayOfString: []string{"my", "values"},
+		ArrayOfNumber: []int64{1, 2, 3},
+		Other: map[string]interface{}{
+			"a": "b",
+			"c": "d",
+		},
+	}
+	expected := Configuration{
+		"defaults":       defaults,
+		"lower-case-key": defaults,
+		"UPPER-CASE-KEY": SubConfiguration{
+			Kbool:         false,
+			Kstring:       "my-other-string",
+			Kint:          12,
+			Kfloat:        float64(13.50),
+			ArrayOfString: []string{"my", "values"},
+			ArrayOfNumber: []int64{1, 2, 3},
+			Other: map[string]interface{}{
+				"a": "b",
+				"c": "d",
+			},
+		},
+		"CamelCaseKey": SubConfiguration{
+			Kint: 92,
+		},
+	}
+
+	t.Run("read correctly yaml configuration resolving anchors and aliases", func(t *testing.T) {
+		var config Configuration
+		err := GetConfigFromFile(configName, configPath, nil, &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, expected)
+	})
+
+	t.Run("read correctly yaml configuration and validate with json schema", func(t *testing.T) {
+		var config Configuration
+		jsonSchema := readFile(t, "./config.schema.test.json")
+		err := GetConfigFromFile(configName, configPath, jsonSchema, &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, expected)
+	})
+
+	t.Run("throws if yaml config file validation fails", func(t *testing.T) {
+		var config Configuration
+		jsonSchema := []byte(`{
+			"type": "object",
+			"additionalProperties": {
+				"type": "object",
+				"properties": {
+					"kint": {"type": "string"}
+				}
+			}
+		}`)
+		err := GetConfigFromFile(configName, configPath, jsonSchema, &config)
+		assert.Assert(t, err != nil, "Error is nil.")
 		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), "Config file error.")
 	})
+
+	t.Run("throw if output struct does not contain yaml config variable", func(t *testing.T) {
+		type MyConfigStructure struct{}
+		var wrongConfig MyConfigStructure
+		err := GetConfigFromFile(configName, configPath, nil, &wrongConfig)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "error unmarshalling file:"), "Config file error.")
+	})
 }
 
 func TestValidateJSONConfig(t *testing.T) {
@@ -205,6 +304,7 @@ func TestValidateJSONConfig(t *testing.T) {
 		wrongSchema := []byte(`{"type": "not-correct-type"}`)
 		err := validateJSONConfig(wrongSchema, document)
 		assert.Assert(t, err != nil, "JSON document should returns error.")
+		assert.Assert(t, errors.Is(err, ErrInvalidSchema), "JSON document should returns invalid schema error.")
 		assert.Assert(t, strings.Contains(err.Error(), "error validating:"), "", "JSON document should returns the correct error.")
 	})
 
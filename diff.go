@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is the change of a configuration value.
+type Change struct {
+	// Path is the path of the value, made of the object keys separated by dots.
+	Path string
+	// Old is the previous value, nil for added values.
+	Old interface{}
+	// New is the current value, nil for removed values.
+	New interface{}
+}
+
+// Diff holds the changes between two versions of a configuration document, sorted by path.
+// Paths are the ones of the leaf values, so the items of an array are compared as a whole.
+type Diff struct {
+	Added   []Change
+	Removed []Change
+	Changed []Change
+}
+
+// IsEmpty reports whether the diff has no changes.
+func (d Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffDocuments returns the changes from the old to the new flattened document.
+func diffDocuments(old, new map[string]interface{}) Diff {
+	var diff Diff
+	for path, newValue := range new {
+		oldValue, ok := old[path]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, Change{Path: path, New: newValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			diff.Changed = append(diff.Changed, Change{Path: path, Old: oldValue, New: newValue})
+		}
+	}
+	for path, oldValue := range old {
+		if _, ok := new[path]; !ok {
+			diff.Removed = append(diff.Removed, Change{Path: path, Old: oldValue})
+		}
+	}
+	sortChanges(diff.Added)
+	sortChanges(diff.Removed)
+	sortChanges(diff.Changed)
+	return diff
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
+
+// filter returns the changes whose path is matched by pattern.
+func (d Diff) filter(pattern []string) Diff {
+	return Diff{
+		Added:   filterChanges(d.Added, pattern),
+		Removed: filterChanges(d.Removed, pattern),
+		Changed: filterChanges(d.Changed, pattern),
+	}
+}
+
+func filterChanges(changes []Change, pattern []string) []Change {
+	var filtered []Change
+	for _, change := range changes {
+		if matchSubscriptionPath(pattern, strings.Split(change.Path, ".")) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// matchSubscriptionPath reports whether path is in the subtree matched by pattern,
+// where a `*` segment matches any key.
+func matchSubscriptionPath(pattern, path []string) bool {
+	if len(path) < len(pattern) {
+		return false
+	}
+	return matchMergePath(pattern, path[:len(pattern)])
+}
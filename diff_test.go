@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDiffDocuments(t *testing.T) {
+	old := map[string]interface{}{
+		"name":         "my-service",
+		"db.host":      "localhost",
+		"db.pool.size": 5,
+		"hosts":        []interface{}{"a", "b"},
+		"debug":        true,
+	}
+	new := map[string]interface{}{
+		"name":         "my-service",
+		"db.host":      "db.local",
+		"db.pool.size": 5,
+		"db.pool.idle": 2,
+		"hosts":        []interface{}{"a", "c"},
+	}
+
+	diff := diffDocuments(old, new)
+	assert.DeepEqual(t, diff, Diff{
+		Added:   []Change{{Path: "db.pool.idle", New: 2}},
+		Removed: []Change{{Path: "debug", Old: true}},
+		Changed: []Change{
+			{Path: "db.host", Old: "localhost", New: "db.local"},
+			{Path: "hosts", Old: []interface{}{"a", "b"}, New: []interface{}{"a", "c"}},
+		},
+	})
+	assert.Assert(t, diffDocuments(old, old).IsEmpty())
+
+	t.Run("filters the changes of a subtree", func(t *testing.T) {
+		assert.DeepEqual(t, diff.filter([]string{"db", "pool"}), Diff{
+			Added: []Change{{Path: "db.pool.idle", New: 2}},
+		})
+		assert.DeepEqual(t, diff.filter([]string{"*", "host"}), Diff{
+			Changed: []Change{{Path: "db.host", Old: "localhost", New: "db.local"}},
+		})
+		assert.DeepEqual(t, diff.filter(nil), diff)
+		assert.Assert(t, diff.filter([]string{"name"}).IsEmpty())
+	})
+}
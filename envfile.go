@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// envFileSuffix is the suffix of the env variables holding the path of a file that contains the
+// value of the variable, such as a secret mounted by Docker or Kubernetes.
+const envFileSuffix = "_FILE"
+
+// lookupEnvFile returns the value of the env variable key, read from the file named by the
+// key_FILE variable if it is set. Setting both key and key_FILE is an error.
+func lookupEnvFile(key string, lookup func(key string) (string, bool)) (string, bool, error) {
+	value, ok := lookup(key)
+	filePath, fileOK := lookup(key + envFileSuffix)
+	if !fileOK {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, newEnvFileConflictError(key)
+	}
+	value, err := readEnvFile(key+envFileSuffix, filePath)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// readEnvFile returns the content of the file named by the fileKey env variable, without the trailing newline.
+func readEnvFile(fileKey, filePath string) (string, error) {
+	content, err := ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("env variable %s: %w", fileKey, err)
+	}
+	value := strings.TrimSuffix(string(content), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+func newEnvFileConflictError(key string) error {
+	return markError(ErrValidation, fmt.Errorf("env variables %s and %s%s are both set", key, key, envFileSuffix))
+}
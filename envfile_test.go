@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestEnvFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeTestFile(t, dir, "db-password", "s3cr3t\n")
+	writeTestFile(t, dir, "api-key", "key\r\n")
+	passwordFile := path.Join(dir, "db-password")
+
+	t.Run("GetEnvVariables reads KEY_FILE variables", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Password string
+			APIKey   string
+		}
+		envConfig := []EnvConfig{
+			{Key: "DB_PASSWORD", Variable: "Password", Required: true},
+			{Key: "API_KEY", Variable: "APIKey", Required: true},
+		}
+
+		var env MyEnvDef
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{
+			"DB_PASSWORD_FILE": passwordFile,
+			"API_KEY_FILE":     path.Join(dir, "api-key"),
+		}))
+		assert.Equal(t, err, nil, "Error getting values.")
+		assert.Equal(t, env, MyEnvDef{Password: "s3cr3t", APIKey: "key"})
+	})
+
+	t.Run("GetEnvVariables fails if both KEY and KEY_FILE are set", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Password string
+		}
+
+		var env MyEnvDef
+		err := GetEnvVariables([]EnvConfig{{Key: "DB_PASSWORD", Variable: "Password"}}, &env, EnvMap(map[string]string{
+			"DB_PASSWORD":      "plain",
+			"DB_PASSWORD_FILE": passwordFile,
+		}))
+		assert.Error(t, err, "env variables DB_PASSWORD and DB_PASSWORD_FILE are both set")
+		assert.Assert(t, errors.Is(err, ErrValidation))
+	})
+
+	t.Run("LoadEnv reads NAME_FILE variables", func(t *testing.T) {
+		t.Parallel()
+		type Configuration struct {
+			Password string `env:"PASSWORD" required:"true"`
+			Token    string `env:"TOKEN"`
+		}
+
+		var config Configuration
+		err := LoadEnv(&config, EnvPrefix("DB_"), EnvMap(map[string]string{"DB_PASSWORD_FILE": passwordFile}))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Password, "s3cr3t")
+
+		err = LoadEnv(&config, EnvMap(map[string]string{"TOKEN_FILE": path.Join(dir, "missing")}))
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist), err)
+		assert.ErrorContains(t, err, "env variable TOKEN_FILE: ")
+	})
+
+	t.Run("env overlays read _FILE variables", func(t *testing.T) {
+		t.Parallel()
+		fsys := fstest.MapFS{
+			"config.json": &fstest.MapFile{Data: []byte(`{"db": {"host": "localhost"}, "log_file": "app.log"}`)},
+		}
+
+		config, err := Load[map[string]interface{}](context.Background(),
+			WithFS(fsys),
+			WithFile("config", "."),
+			WithEnvOverlay("APP"),
+			WithEnvMap(map[string]string{
+				"APP_DB__PASSWORD_FILE": passwordFile,
+				"APP_LOG_FILE":          "service.log",
+			}),
+		)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, map[string]interface{}{
+			"db":       map[string]interface{}{"host": "localhost", "password": "s3cr3t"},
+			"log_file": "service.log",
+		})
+
+		_, err = Load[map[string]interface{}](context.Background(),
+			WithFS(fsys),
+			WithEnvOverlay("APP"),
+			WithEnvMap(map[string]string{
+				"APP_DB__PASSWORD":      "plain",
+				"APP_DB__PASSWORD_FILE": passwordFile,
+			}),
+		)
+		assert.Error(t, err, "error loading env overlay: env variables APP_DB__PASSWORD and APP_DB__PASSWORD_FILE are both set")
+	})
+}
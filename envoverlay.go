@@ -0,0 +1,374 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type envSource struct {
+	prefix string
+}
+
+// EnvSource is made of the environment variables starting with prefix followed by an underscore.
+// The rest of the variable name is split on double underscores to build the key path, so
+// APP_DB__POOL__SIZE sets db.pool.size when prefix is APP.
+//
+// Each segment of the name is matched case insensitively, and with underscores matching dashes,
+// against the keys already set by the previous sources and the properties of the json schema,
+// falling back to the lower cased segment. Values are converted to the type declared in the json
+// schema for their key: integers, numbers, booleans, objects and arrays, written either in json
+// or as comma separated values. Without a declared type values are kept as strings.
+// Arrays are set as a whole: loading fails if a variable addresses the items of an array.
+//
+// Variables ending with _FILE, whose name does not match an existing key, follow the Docker secrets
+// convention: APP_DB__PASSWORD_FILE sets db.password to the content of the file it names.
+func EnvSource(prefix string) Source {
+	return envSource{prefix: prefix}
+}
+
+func (s envSource) String() string {
+	return fmt.Sprintf("env variables with prefix %s", s.prefix)
+}
+
+func (s envSource) load(ctx context.Context, l *Loader) (map[string]interface{}, map[string]Position, error) {
+	builder, err := l.newDocumentBuilder()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.patch(ctx, builder); err != nil {
+		return nil, nil, err
+	}
+	return builder.document, builder.positions, nil
+}
+
+func (s envSource) patch(_ context.Context, b *documentBuilder) error {
+	prefix := s.prefix + "_"
+	variables := map[string]string{}
+	for _, variable := range b.loader.environ() {
+		name, value, ok := strings.Cut(variable, "=")
+		if ok && strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			variables[name] = value
+		}
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overlay := map[string]interface{}{}
+	positions := map[string]Position{}
+	for _, name := range names {
+		segments := strings.Split(name[len(prefix):], "__")
+		if containsEmptySegment(segments) {
+			continue
+		}
+
+		var document interface{} = b.document
+		schema := b.schema
+		current := overlay
+		pointer := ""
+		envValue := variables[name]
+		for i, segment := range segments {
+			if isEnvArray(document, schema) {
+				return fmt.Errorf("error loading env overlay: env variable %s: %w", name,
+					markError(ErrValidation, fmt.Errorf("%s is an array: its items can not be set one by one", pointer)))
+			}
+			if i == len(segments)-1 {
+				base, ok := strings.CutSuffix(segment, envFileSuffix)
+				if ok && base != "" && !envKeyExists(segment, document, schema) {
+					if _, ok := variables[strings.TrimSuffix(name, envFileSuffix)]; ok {
+						return fmt.Errorf("error loading env overlay: %w", newEnvFileConflictError(strings.TrimSuffix(name, envFileSuffix)))
+					}
+					value, err := readEnvFile(name, envValue)
+					if err != nil {
+						return fmt.Errorf("error loading env overlay: %w", err)
+					}
+					segment, envValue = base, value
+				}
+			}
+			key := resolveEnvKey(segment, document, schema)
+			pointer += "/" + escapeJSONPointerToken(key)
+			positions[pointer] = Position{File: "env " + name}
+			schema = propertySchema(schema, key)
+			if object, ok := document.(map[string]interface{}); ok {
+				document = object[key]
+			} else {
+				document = nil
+			}
+
+			if i == len(segments)-1 {
+				value, err := overlayCoercion.coerce(envValue, schema)
+				if err != nil {
+					return fmt.Errorf("error loading env overlay: env variable %s: %w", name, err)
+				}
+				current[key] = value
+				walkDocument(value, pointer, func(pointer string) {
+					positions[pointer] = Position{File: "env " + name}
+				})
+				break
+			}
+			next, ok := current[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				current[key] = next
+			}
+			current = next
+		}
+	}
+
+	b.merge(overlay, positions)
+	return nil
+}
+
+// isEnvArray reports whether the document value, or its json schema, is an array.
+func isEnvArray(document interface{}, schema map[string]interface{}) bool {
+	if _, ok := document.([]interface{}); ok {
+		return true
+	}
+	for _, schemaType := range schemaTypes(schema) {
+		if schemaType == "array" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsEmptySegment(segments []string) bool {
+	for _, segment := range segments {
+		if segment == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEnvKey returns the key of the document or of the schema properties matching the
+// env variable name segment, or the lower cased segment if none matches.
+func resolveEnvKey(segment string, document interface{}, schema map[string]interface{}) string {
+	normalized := normalizeEnvKey(segment)
+	if object, ok := document.(map[string]interface{}); ok {
+		if key, ok := matchEnvKey(normalized, object); ok {
+			return key
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		if key, ok := matchEnvKey(normalized, properties); ok {
+			return key
+		}
+	}
+	return strings.ToLower(segment)
+}
+
+// envKeyExists reports whether the env variable name segment matches a key of the document or
+// of the schema properties.
+func envKeyExists(segment string, document interface{}, schema map[string]interface{}) bool {
+	normalized := normalizeEnvKey(segment)
+	if object, ok := document.(map[string]interface{}); ok {
+		if _, ok := matchEnvKey(normalized, object); ok {
+			return true
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	_, ok := matchEnvKey(normalized, properties)
+	return ok
+}
+
+func matchEnvKey(normalized string, object map[string]interface{}) (string, bool) {
+	if _, ok := object[normalized]; ok {
+		return normalized, true
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if normalizeEnvKey(key) == normalized {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func normalizeEnvKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+// propertySchema returns the json schema of the key property of an object schema.
+func propertySchema(schema map[string]interface{}, key string) map[string]interface{} {
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			return property
+		}
+	}
+	if additionalProperties, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		return additionalProperties
+	}
+	return nil
+}
+
+func schemaTypes(schema map[string]interface{}) []string {
+	switch schemaType := schema["type"].(type) {
+	case string:
+		return []string{schemaType}
+	case []interface{}:
+		types := make([]string, 0, len(schemaType))
+		for _, item := range schemaType {
+			if typeName, ok := item.(string); ok {
+				types = append(types, typeName)
+			}
+		}
+		return types
+	default:
+		return nil
+	}
+}
+
+// envCoercion sets how env variable values are converted to the types declared in their json
+// schema, so that the validated values match the ones that are decoded.
+type envCoercion struct {
+	// separator separates the items of arrays and the key:value entries of objects.
+	separator string
+	// integerBase is the base integers are parsed in, as by strconv.ParseInt.
+	integerBase int
+	// lenient trims the spaces around values, and reads arrays and objects written in json.
+	lenient bool
+}
+
+// overlayCoercion converts the values of the env overlay.
+var overlayCoercion = envCoercion{separator: ",", integerBase: 10, lenient: true}
+
+// coerce converts an env variable value to the type declared in its json schema.
+// When more types are declared, the string type is tried last.
+func (c envCoercion) coerce(value string, schema map[string]interface{}) (interface{}, error) {
+	types := schemaTypes(schema)
+	if len(types) == 0 {
+		return value, nil
+	}
+
+	acceptsString := false
+	for _, schemaType := range types {
+		if schemaType == "string" {
+			acceptsString = true
+			continue
+		}
+		if converted, ok := c.convert(value, schemaType, schema); ok {
+			return converted, nil
+		}
+	}
+	if acceptsString {
+		return value, nil
+	}
+	return nil, markError(ErrValidation, fmt.Errorf("value %q is not of type %s", value, strings.Join(types, " or ")))
+}
+
+func (c envCoercion) convert(value, schemaType string, schema map[string]interface{}) (interface{}, bool) {
+	if c.lenient {
+		value = strings.TrimSpace(value)
+	}
+	switch schemaType {
+	case "integer":
+		converted, err := strconv.ParseInt(value, c.integerBase, 64)
+		return converted, err == nil
+	case "number":
+		converted, err := strconv.ParseFloat(value, 64)
+		return converted, err == nil
+	case "boolean":
+		converted, err := strconv.ParseBool(value)
+		return converted, err == nil
+	case "null":
+		return nil, value == "" || value == "null"
+	case "object":
+		if c.lenient {
+			var converted map[string]interface{}
+			err := json.Unmarshal([]byte(value), &converted)
+			return converted, err == nil && converted != nil
+		}
+		converted := map[string]interface{}{}
+		for _, entry := range splitEnvValue(value, c.separator) {
+			entryKey, entryValue, ok := strings.Cut(entry, ":")
+			if !ok {
+				return nil, false
+			}
+			convertedValue, err := c.coerce(entryValue, propertySchema(schema, entryKey))
+			if err != nil {
+				return nil, false
+			}
+			converted[entryKey] = convertedValue
+		}
+		return converted, true
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if c.lenient && strings.HasPrefix(value, "[") {
+			var decoded []interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return nil, false
+			}
+			converted := make([]interface{}, 0, len(decoded))
+			for _, item := range decoded {
+				convertedItem, ok := c.coerceJSON(item, items)
+				if !ok {
+					return nil, false
+				}
+				converted = append(converted, convertedItem)
+			}
+			return converted, true
+		}
+		converted := []interface{}{}
+		for _, item := range splitEnvValue(value, c.separator) {
+			if c.lenient {
+				item = strings.TrimSpace(item)
+			}
+			convertedItem, err := c.coerce(item, items)
+			if err != nil {
+				return nil, false
+			}
+			converted = append(converted, convertedItem)
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
+
+// coerceJSON converts a value decoded from json to the type declared in its json schema,
+// as coerce does for the separated items: integer numbers become int64 and strings are
+// converted as env variable values.
+func (c envCoercion) coerceJSON(value interface{}, schema map[string]interface{}) (interface{}, bool) {
+	switch value := value.(type) {
+	case float64:
+		for _, schemaType := range schemaTypes(schema) {
+			if schemaType == "integer" && value == math.Trunc(value) && math.Abs(value) < math.MaxInt64 {
+				return int64(value), true
+			}
+		}
+		return value, true
+	case string:
+		converted, err := c.coerce(value, schema)
+		return converted, err == nil
+	default:
+		return value, true
+	}
+}
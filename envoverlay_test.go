@@ -0,0 +1,181 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestEnvOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.json": &fstest.MapFile{Data: []byte(`{
+			"serviceName": "my-service",
+			"db": {"host": "localhost", "pool": {"size": 5}},
+			"array-of-string": ["a"]
+		}`)},
+	}
+	jsonSchema := []byte(`{
+		"type": "object",
+		"properties": {
+			"serviceName": {"type": "string"},
+			"debug": {"type": "boolean"},
+			"ratio": {"type": ["number", "null"]},
+			"db": {
+				"type": "object",
+				"properties": {
+					"host": {"type": "string"},
+					"pool": {
+						"type": "object",
+						"properties": {"size": {"type": "integer", "maximum": 100}}
+					}
+				}
+			},
+			"array-of-string": {"type": "array", "items": {"type": "string"}},
+			"ports": {"type": "array", "items": {"type": "integer"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"limits": {"type": "object", "additionalProperties": {"type": "integer"}}
+		}
+	}`)
+	load := func(t *testing.T, environ []string, opts ...Option) (map[string]interface{}, error) {
+		t.Helper()
+		opts = append([]Option{WithFS(fsys), WithFile("config", "."), WithEnvOverlay("APP")}, opts...)
+		loader := NewLoader(opts...)
+		loader.environ = func() []string { return environ }
+
+		var config map[string]interface{}
+		err := loader.Load(context.Background(), &config)
+		return config, err
+	}
+
+	t.Run("coerce values to the json schema types before validation", func(t *testing.T) {
+		config, err := load(t, []string{
+			"APP_DB__POOL__SIZE=20",
+			"APP_DEBUG=true",
+			"APP_RATIO=0.5",
+			"APP_PORTS=80, 443",
+			"APP_LABELS__TEAM=core",
+			"APP_LIMITS__CPU=2",
+			"OTHER_DEBUG=false",
+		}, WithSchema(jsonSchema))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, map[string]interface{}{
+			"serviceName":     "my-service",
+			"debug":           true,
+			"ratio":           0.5,
+			"db":              map[string]interface{}{"host": "localhost", "pool": map[string]interface{}{"size": int64(20)}},
+			"array-of-string": []interface{}{"a"},
+			"ports":           []interface{}{int64(80), int64(443)},
+			"labels":          map[string]interface{}{"team": "core"},
+			"limits":          map[string]interface{}{"cpu": int64(2)},
+		})
+	})
+
+	t.Run("match keys case insensitively with underscores as dashes", func(t *testing.T) {
+		config, err := load(t, []string{
+			"APP_SERVICENAME=overridden",
+			"APP_ARRAY_OF_STRING=b,c",
+		}, WithSchema(jsonSchema))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config["serviceName"], "overridden")
+		assert.DeepEqual(t, config["array-of-string"], []interface{}{"b", "c"})
+		_, ok := config["servicename"]
+		assert.Assert(t, !ok, "Key is not matched with the existing one.")
+	})
+
+	t.Run("match keys of the document without json schema and keep strings", func(t *testing.T) {
+		config, err := load(t, []string{"APP_SERVICENAME=overridden", "APP_DB__POOL__SIZE=20", "APP_NEW__KEY=value"})
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config["serviceName"], "overridden")
+		assert.DeepEqual(t, config["db"], map[string]interface{}{"host": "localhost", "pool": map[string]interface{}{"size": "20"}})
+		assert.DeepEqual(t, config["new"], map[string]interface{}{"key": "value"})
+	})
+
+	t.Run("accept json values for arrays and objects", func(t *testing.T) {
+		config, err := load(t, []string{`APP_PORTS=[1, 2]`, `APP_LABELS={"team": "core"}`}, WithSchema(jsonSchema))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config["ports"], []interface{}{int64(1), int64(2)})
+		assert.DeepEqual(t, config["labels"], map[string]interface{}{"team": "core"})
+
+		commaConfig, err := load(t, []string{`APP_PORTS=1,2`}, WithSchema(jsonSchema))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, commaConfig["ports"], config["ports"])
+	})
+
+	t.Run("throws naming the variable if it sets the items of an array", func(t *testing.T) {
+		_, err := load(t, []string{"APP_ARRAY_OF_STRING__0=b"})
+		assert.Assert(t, errors.Is(err, ErrValidation), "Error is not a validation error: %v", err)
+		assert.Error(t, err, "error loading env overlay: env variable APP_ARRAY_OF_STRING__0: /array-of-string is an array: its items can not be set one by one")
+
+		_, err = load(t, []string{"APP_PORTS__1__NUMBER=9"}, WithSchema(jsonSchema))
+		assert.Error(t, err, "error loading env overlay: env variable APP_PORTS__1__NUMBER: /ports is an array: its items can not be set one by one")
+	})
+
+	t.Run("ignore variables with empty segments", func(t *testing.T) {
+		config, err := load(t, []string{"APP_DB____HOST=value", "APP_DB__=value"})
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config["db"], map[string]interface{}{"host": "localhost", "pool": map[string]interface{}{"size": float64(5)}})
+	})
+
+	t.Run("throws naming the variable if value can not be coerced", func(t *testing.T) {
+		_, err := load(t, []string{"APP_DB__POOL__SIZE=many"}, WithSchema(jsonSchema))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Equal(t, err.Error(), `error loading env overlay: env variable APP_DB__POOL__SIZE: value "many" is not of type integer`)
+	})
+
+	t.Run("throws if coerced value is not valid", func(t *testing.T) {
+		_, err := load(t, []string{"APP_DB__POOL__SIZE=200"}, WithSchema(jsonSchema))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), err.Error())
+	})
+}
+
+func TestEnvCoercion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		schema   map[string]interface{}
+		expected interface{}
+	}{
+		{name: "without schema", value: "10", schema: nil, expected: "10"},
+		{name: "integer", value: "10", schema: map[string]interface{}{"type": "integer"}, expected: int64(10)},
+		{name: "number", value: "1.5", schema: map[string]interface{}{"type": "number"}, expected: 1.5},
+		{name: "boolean", value: "false", schema: map[string]interface{}{"type": "boolean"}, expected: false},
+		{name: "null", value: "", schema: map[string]interface{}{"type": []interface{}{"integer", "null"}}, expected: nil},
+		{name: "string tried last", value: "abc", schema: map[string]interface{}{"type": []interface{}{"string", "integer"}}, expected: "abc"},
+		{name: "string after other types", value: "10", schema: map[string]interface{}{"type": []interface{}{"string", "integer"}}, expected: int64(10)},
+		{name: "empty array", value: "", schema: map[string]interface{}{"type": "array"}, expected: []interface{}{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run("coerce "+testCase.name, func(t *testing.T) {
+			value, err := overlayCoercion.coerce(testCase.value, testCase.schema)
+			assert.Equal(t, err, nil, "Error is not nil.")
+			assert.DeepEqual(t, value, testCase.expected)
+		})
+	}
+
+	t.Run("throws if array item can not be coerced", func(t *testing.T) {
+		_, err := overlayCoercion.coerce("1,a", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}})
+		assert.Assert(t, err != nil, "Error is nil.")
+	})
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// envSchemaValue is an env variable value, converted to the type declared in the json schema at path.
+type envSchemaValue struct {
+	path  []string
+	key   string
+	value interface{}
+}
+
+// addSchemaValue converts the value of the env variable key to the type declared in the json schema
+// at path, if a json schema is set, and records it to be validated. The separator is the one the
+// items of the value are decoded with. The returned error reports a value that can not be
+// converted, so that the variable can be left out of the decoding and reported once.
+func (l *envLoader) addSchemaValue(path []string, key, value, separator string) error {
+	if l.jsonSchema == nil {
+		return nil
+	}
+	schema, err := l.schema()
+	if err != nil {
+		// reported by validateSchema
+		return nil
+	}
+	for _, segment := range path {
+		schema = propertySchema(schema, segment)
+	}
+	// integers are parsed as they are decoded, with their base prefix
+	coercion := envCoercion{separator: separator, integerBase: 0}
+	converted, err := coercion.coerce(value, schema)
+	if err != nil {
+		l.schemaValuesInvalid = true
+		return fmt.Errorf("env variable %s: %w", key, err)
+	}
+	l.schemaValues = append(l.schemaValues, envSchemaValue{path: path, key: key, value: converted})
+	return nil
+}
+
+// schema returns the parsed json schema.
+func (l *envLoader) schema() (map[string]interface{}, error) {
+	if l.parsedSchema == nil {
+		if err := json.Unmarshal(l.jsonSchema, &l.parsedSchema); err != nil {
+			return nil, markError(ErrInvalidSchema, fmt.Errorf("env variables not valid: error reading json schema: %w", err))
+		}
+	}
+	return l.parsedSchema, nil
+}
+
+// validateSchema validates the recorded values with the json schema, if set. Validation errors
+// report the env variable of each field. The validation is skipped if a value could not be
+// converted, since the document would lack it.
+func (l *envLoader) validateSchema() error {
+	if l.jsonSchema == nil || l.schemaValuesInvalid {
+		return nil
+	}
+	if _, err := l.schema(); err != nil {
+		return err
+	}
+
+	document := map[string]interface{}{}
+	positions := map[string]Position{}
+	for _, schemaValue := range l.schemaValues {
+		current := document
+		pointer := ""
+		for i, segment := range schemaValue.path {
+			pointer += "/" + escapeJSONPointerToken(segment)
+			if i < len(schemaValue.path)-1 {
+				next, ok := current[segment].(map[string]interface{})
+				if !ok {
+					next = map[string]interface{}{}
+					current[segment] = next
+				}
+				current = next
+				continue
+			}
+			current[segment] = schemaValue.value
+			positions[pointer] = Position{File: "env " + schemaValue.key}
+		}
+	}
+
+	jsonDocument, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("env variables stringify failed: %w", err)
+	}
+	if err := validateJSONConfig(l.jsonSchema, jsonDocument); err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			for i := range validationErr.Errors {
+				validationErr.Errors[i].Position, _ = lookupPosition(positions, validationErr.Errors[i].Pointer)
+			}
+		}
+		return fmt.Errorf("env variables not valid: %w", err)
+	}
+	return nil
+}
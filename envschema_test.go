@@ -0,0 +1,159 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestEnvSchema(t *testing.T) {
+	t.Parallel()
+
+	t.Run("GetEnvVariables validates the object built from the env config", func(t *testing.T) {
+		t.Parallel()
+		type Database struct {
+			Host string
+			Port int
+		}
+		type MyEnvDef struct {
+			Level    string
+			Database Database
+		}
+		schema := []byte(`{
+			"type": "object",
+			"required": ["Level"],
+			"properties": {
+				"Level": {"enum": ["debug", "info"]},
+				"Database": {
+					"type": "object",
+					"properties": {"Port": {"type": "integer", "maximum": 65535}}
+				}
+			}
+		}`)
+		envConfig := []EnvConfig{
+			{Key: "LEVEL", Variable: "Level", DefaultValue: "info"},
+			{Key: "DB_HOST", Variable: "Database.Host"},
+			{Key: "DB_PORT", Variable: "Database.Port"},
+		}
+
+		var env MyEnvDef
+		err := GetEnvVariables(envConfig, &env, EnvSchema(schema), EnvMap(map[string]string{"DB_PORT": "5432"}))
+		assert.Equal(t, err, nil, "Error getting values.")
+		assert.Equal(t, env, MyEnvDef{Level: "info", Database: Database{Port: 5432}})
+
+		err = GetEnvVariables(envConfig, &env, EnvSchema(schema), EnvMap(map[string]string{"DB_PORT": "70000", "LEVEL": "trace"}))
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Assert(t, errors.Is(err, ErrValidation))
+		assert.DeepEqual(t, fieldErrorMessages(validationErr), map[string]string{
+			"/Level":         "env LEVEL: /Level: Level must be one of the following: \"debug\", \"info\"",
+			"/Database/Port": "env DB_PORT: /Database/Port: Must be less than or equal to 65535",
+		})
+
+		err = GetEnvVariables(envConfig, &env, EnvSchema(schema), EnvMap(map[string]string{"DB_PORT": "not-a-port"}))
+		assert.Assert(t, errors.Is(err, ErrValidation))
+		assert.Error(t, err, `env variable DB_PORT: value "not-a-port" is not of type integer`)
+	})
+
+	t.Run("LoadEnv validates the object of the env variables", func(t *testing.T) {
+		t.Parallel()
+		type Configuration struct {
+			Replicas int      `env:"REPLICAS" default:"1"`
+			Hosts    []string `env:"HOSTS"`
+		}
+		schema := []byte(`{
+			"properties": {
+				"APP_REPLICAS": {"type": "integer", "minimum": 1},
+				"APP_HOSTS": {"type": "array", "items": {"type": "string", "format": "hostname"}, "minItems": 1}
+			},
+			"required": ["APP_HOSTS"]
+		}`)
+
+		var config Configuration
+		err := LoadEnv(&config, EnvPrefix("APP_"), EnvSchema(schema), EnvMap(map[string]string{"APP_HOSTS": "a.local,b.local"}))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{Replicas: 1, Hosts: []string{"a.local", "b.local"}})
+
+		err = LoadEnv(&config, EnvPrefix("APP_"), EnvSchema(schema), EnvMap(map[string]string{"APP_REPLICAS": "0"}))
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.DeepEqual(t, fieldErrorMessages(validationErr), map[string]string{
+			"/APP_HOSTS":    "/APP_HOSTS: APP_HOSTS is required",
+			"/APP_REPLICAS": "env APP_REPLICAS: /APP_REPLICAS: Must be greater than or equal to 1",
+		})
+	})
+
+	t.Run("LoadEnv validates the values as they are decoded", func(t *testing.T) {
+		t.Parallel()
+		type Configuration struct {
+			Hosts  []string          `env:"HOSTS" sep:";"`
+			Mode   int               `env:"MODE"`
+			Limits map[string]string `env:"LIMITS"`
+		}
+		schema := []byte(`{
+			"properties": {
+				"HOSTS": {"type": "array", "items": {"type": "string", "pattern": "^[a-z,]+$"}, "minItems": 2},
+				"MODE": {"type": "integer", "maximum": 511},
+				"LIMITS": {"type": "object", "properties": {"cpu": {"type": "integer"}}}
+			}
+		}`)
+
+		var config Configuration
+		err := LoadEnv(&config, EnvSchema(schema), EnvMap(map[string]string{"HOSTS": "a,b;c", "MODE": "0o644", "LIMITS": "cpu:2"}))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{Hosts: []string{"a,b", "c"}, Mode: 0o644, Limits: map[string]string{"cpu": "2"}})
+
+		err = LoadEnv(&config, EnvSchema(schema), EnvMap(map[string]string{"HOSTS": "a,b"}))
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.DeepEqual(t, fieldErrorMessages(validationErr), map[string]string{
+			"/HOSTS": "env HOSTS: /HOSTS: Array must have at least 2 items",
+		})
+
+		err = LoadEnv(&config, EnvSchema(schema), EnvMap(map[string]string{"MODE": "0x200"}))
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.DeepEqual(t, fieldErrorMessages(validationErr), map[string]string{
+			"/MODE": "env MODE: /MODE: Must be less than or equal to 511",
+		})
+
+		err = LoadEnv(&config, EnvSchema(schema), EnvMap(map[string]string{"LIMITS": "cpu:many", "MODE": "abc"}))
+		assert.Assert(t, errors.Is(err, ErrValidation))
+		assert.Error(t, err, `env variable MODE: value "abc" is not of type integer
+env variable LIMITS: value "cpu:many" is not of type object`)
+	})
+
+	t.Run("returns an error for an invalid json schema", func(t *testing.T) {
+		t.Parallel()
+		type Configuration struct {
+			Name string `env:"NAME"`
+		}
+		var config Configuration
+		err := LoadEnv(&config, EnvSchema([]byte(`{`)))
+		assert.Assert(t, errors.Is(err, ErrInvalidSchema))
+	})
+}
+
+func fieldErrorMessages(validationErr *ValidationError) map[string]string {
+	messages := map[string]string{}
+	for _, fieldError := range validationErr.Errors {
+		messages[fieldError.Pointer] = fieldError.Error()
+	}
+	return messages
+}
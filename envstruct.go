@@ -0,0 +1,291 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultEnvSeparator separates the items of slices and maps read from env variables.
+const defaultEnvSeparator = ","
+
+// EnvOption configures how LoadEnv and GetEnvVariables read env variables.
+type EnvOption func(*envLoader)
+
+// EnvPrefix sets the prefix prepended to all the env variable names.
+func EnvPrefix(prefix string) EnvOption {
+	return func(l *envLoader) {
+		l.prefix = prefix
+	}
+}
+
+// EnvLookup sets the function env variables are read with, os.LookupEnv by default.
+// It makes env loading independent from the process environment, for instance in tests.
+func EnvLookup(lookup func(key string) (string, bool)) EnvOption {
+	return func(l *envLoader) {
+		l.lookup = lookup
+	}
+}
+
+// EnvMap reads the env variables from env instead of the process environment.
+func EnvMap(env map[string]string) EnvOption {
+	return EnvLookup(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+}
+
+// EnvSchema sets the json schema the env variables are validated with. Values are converted to the
+// types declared in the schema before the validation, as they are decoded: arrays are split with
+// the separator of their field, map entries are read as key:value objects and integers may have
+// a base prefix.
+// GetEnvVariables validates the object built from the EnvConfig entries, where the dot separated
+// Variable is the path of each value, while LoadEnv validates the object whose keys are the
+// names of the env variables.
+func EnvSchema(jsonSchema []byte) EnvOption {
+	return func(l *envLoader) {
+		l.jsonSchema = jsonSchema
+	}
+}
+
+type envLoader struct {
+	prefix     string
+	lookup     func(key string) (string, bool)
+	jsonSchema []byte
+	// parsedSchema is jsonSchema, once parsed.
+	parsedSchema map[string]interface{}
+	// schemaValues are the values validated with the json schema.
+	schemaValues []envSchemaValue
+	// schemaValuesInvalid is set when a value can not be converted to its json schema type.
+	schemaValuesInvalid bool
+}
+
+func newEnvLoader(opts []EnvOption) *envLoader {
+	l := &envLoader{lookup: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LoadEnv reads the env variables into output, which must be a non nil pointer to a struct.
+// The variables are configured with the tags of the struct fields:
+//
+//	type Configuration struct {
+//		Port     int               `env:"PORT" default:"3000"`
+//		Hosts    []string          `env:"HOSTS" required:"true"`
+//		Labels   map[string]string `env:"LABELS" sep:";"`
+//		Timeout  time.Duration     `env:"TIMEOUT" default:"5s"`
+//		Database Database          `envPrefix:"DB_"`
+//	}
+//
+// Fields of struct type without the env tag are read recursively, prefixing the names of their
+// variables with the envPrefix tag. Slices and maps are read as sep separated values, where map
+// entries are written as key:value, while byte slices hold the raw value. Fields implementing
+// encoding.TextUnmarshaler are read with it.
+// If the NAME_FILE variable is set, the value is read from the file it names, such as a mounted secret.
+// All the missing and unparsable variables are reported at once, joined in the returned error,
+// and output is left untouched if any variable is not valid.
+func LoadEnv(output interface{}, opts ...EnvOption) error {
+	value := reflect.ValueOf(output)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return markError(ErrDecode, fmt.Errorf("unsupported env output type %T: it must be a non nil pointer to a struct", output))
+	}
+
+	l := newEnvLoader(opts)
+
+	// decode into a copy, so that output is not partially set on errors
+	target := reflect.New(value.Elem().Type()).Elem()
+	target.Set(value.Elem())
+	errs := l.loadStruct(target, l.prefix)
+	if err := l.validateSchema(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	value.Elem().Set(target)
+	return nil
+}
+
+func (l *envLoader) loadStruct(value reflect.Value, prefix string) []error {
+	var errs []error
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if isEnvStruct(field.Type) {
+				fieldValue := value.Field(i)
+				if fieldValue.Kind() == reflect.Pointer {
+					if fieldValue.IsNil() {
+						fieldValue.Set(reflect.New(field.Type.Elem()))
+					}
+					fieldValue = fieldValue.Elem()
+				}
+				errs = append(errs, l.loadStruct(fieldValue, prefix+field.Tag.Get("envPrefix"))...)
+			}
+			continue
+		}
+
+		key := prefix + name
+		envValue, ok, err := lookupEnvFile(key, l.lookup)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			if required, _ := strconv.ParseBool(field.Tag.Get("required")); required {
+				errs = append(errs, markError(ErrMissingEnv, fmt.Errorf("required env variable %s not set", key)))
+				continue
+			}
+			if envValue, ok = field.Tag.Lookup("default"); !ok {
+				continue
+			}
+		}
+
+		separator, ok := field.Tag.Lookup("sep")
+		if !ok {
+			separator = defaultEnvSeparator
+		}
+		if err := l.addSchemaValue([]string{key}, key, envValue, separator); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := setEnvValue(value.Field(i), envValue, separator); err != nil {
+			errs = append(errs, markError(ErrDecode, fmt.Errorf("env variable %s: %w", key, err)))
+		}
+	}
+	return errs
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isEnvStruct reports whether values of type t are read field by field.
+func isEnvStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// setEnvValue parses envValue according to the type of value, and sets it.
+func setEnvValue(value reflect.Value, envValue, separator string) error {
+	if value.Kind() == reflect.Pointer {
+		parsed := reflect.New(value.Type().Elem())
+		if err := setEnvValue(parsed.Elem(), envValue, separator); err != nil {
+			return err
+		}
+		value.Set(parsed)
+		return nil
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(envValue))
+	}
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(envValue)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(envValue)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(envValue)
+		if err != nil {
+			return fmt.Errorf("cannot parse %q as bool", envValue)
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(envValue, 0, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot parse %q as %s", envValue, value.Kind())
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(envValue, 0, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot parse %q as %s", envValue, value.Kind())
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(envValue, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot parse %q as %s", envValue, value.Kind())
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			// byte slices hold the raw value
+			value.SetBytes([]byte(envValue))
+			return nil
+		}
+		items := splitEnvValue(envValue, separator)
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setEnvValue(slice.Index(i), item, separator); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		value.Set(slice)
+	case reflect.Map:
+		entries := reflect.MakeMap(value.Type())
+		for _, entry := range splitEnvValue(envValue, separator) {
+			entryKey, entryValue, ok := strings.Cut(entry, ":")
+			if !ok {
+				return fmt.Errorf("map entry %q is not in the key:value format", entry)
+			}
+			parsedKey := reflect.New(value.Type().Key()).Elem()
+			if err := setEnvValue(parsedKey, entryKey, separator); err != nil {
+				return fmt.Errorf("map key %q: %w", entryKey, err)
+			}
+			parsedValue := reflect.New(value.Type().Elem()).Elem()
+			if err := setEnvValue(parsedValue, entryValue, separator); err != nil {
+				return fmt.Errorf("map entry %q: %w", entryKey, err)
+			}
+			entries.SetMapIndex(parsedKey, parsedValue)
+		}
+		value.Set(entries)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+func splitEnvValue(envValue, separator string) []string {
+	if envValue == "" {
+		return nil
+	}
+	return strings.Split(envValue, separator)
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestLoadEnv(t *testing.T) {
+	type Database struct {
+		Host string `env:"HOST" default:"localhost"`
+		Port int    `env:"PORT" default:"5432"`
+	}
+	type Configuration struct {
+		Name     string            `env:"NAME" required:"true"`
+		Debug    bool              `env:"DEBUG"`
+		Ratio    float64           `env:"RATIO" default:"0.5"`
+		Hosts    []string          `env:"HOSTS"`
+		Ports    []uint16          `env:"PORTS" sep:";"`
+		Labels   map[string]string `env:"LABELS"`
+		Timeout  time.Duration     `env:"TIMEOUT" default:"5s"`
+		Address  net.IP            `env:"ADDRESS"`
+		Retries  *int              `env:"RETRIES"`
+		Token    []byte            `env:"TOKEN"`
+		Database Database          `envPrefix:"DB_"`
+		Replica  *Database         `envPrefix:"REPLICA_"`
+	}
+
+	t.Run("reads env variables following the struct tags", func(t *testing.T) {
+		t.Setenv("APP_NAME", "my-service")
+		t.Setenv("APP_DEBUG", "true")
+		t.Setenv("APP_HOSTS", "a,b")
+		t.Setenv("APP_PORTS", "80;443")
+		t.Setenv("APP_LABELS", "app:api,tier:backend")
+		t.Setenv("APP_ADDRESS", "10.0.0.1")
+		t.Setenv("APP_RETRIES", "3")
+		t.Setenv("APP_TOKEN", "abc,def")
+		t.Setenv("APP_DB_HOST", "db.local")
+		t.Setenv("APP_REPLICA_PORT", "5433")
+
+		var config Configuration
+		err := LoadEnv(&config, EnvPrefix("APP_"))
+		assert.Equal(t, err, nil, "Error is not nil.")
+
+		retries := 3
+		assert.DeepEqual(t, config, Configuration{
+			Name:     "my-service",
+			Debug:    true,
+			Ratio:    0.5,
+			Hosts:    []string{"a", "b"},
+			Ports:    []uint16{80, 443},
+			Labels:   map[string]string{"app": "api", "tier": "backend"},
+			Timeout:  5 * time.Second,
+			Address:  net.ParseIP("10.0.0.1"),
+			Retries:  &retries,
+			Token:    []byte("abc,def"),
+			Database: Database{Host: "db.local", Port: 5432},
+			Replica:  &Database{Host: "localhost", Port: 5433},
+		})
+	})
+
+	t.Run("keeps the output values of the unset variables without default", func(t *testing.T) {
+		t.Setenv("NAME", "my-service")
+
+		config := Configuration{Debug: true, Hosts: []string{"a"}}
+		err := LoadEnv(&config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Debug, true)
+		assert.DeepEqual(t, config.Hosts, []string{"a"})
+	})
+
+	t.Run("returns all the missing and unparsable variables at once", func(t *testing.T) {
+		t.Setenv("DEBUG", "maybe")
+		t.Setenv("TIMEOUT", "5 minutes")
+		t.Setenv("LABELS", "app")
+
+		config := Configuration{Name: "unchanged"}
+		err := LoadEnv(&config)
+		assert.Assert(t, errors.Is(err, ErrMissingEnv))
+		assert.Assert(t, errors.Is(err, ErrDecode))
+		assert.Error(t, err, `required env variable NAME not set
+env variable DEBUG: cannot parse "maybe" as bool
+env variable LABELS: map entry "app" is not in the key:value format
+env variable TIMEOUT: time: unknown unit " minutes" in duration "5 minutes"`)
+		assert.Equal(t, config.Name, "unchanged")
+	})
+
+	t.Run("reads env variables with the given lookup", func(t *testing.T) {
+		t.Parallel()
+		var config Configuration
+		err := LoadEnv(&config, EnvMap(map[string]string{"NAME": "my-service", "DB_PORT": "5433"}))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Name, "my-service")
+		assert.Equal(t, config.Database, Database{Host: "localhost", Port: 5433})
+
+		err = LoadEnv(&config, EnvLookup(func(key string) (string, bool) { return "", false }))
+		assert.Assert(t, errors.Is(err, ErrMissingEnv))
+	})
+
+	t.Run("rejects outputs that are not pointers to structs", func(t *testing.T) {
+		var config Configuration
+		assert.Assert(t, errors.Is(LoadEnv(config), ErrDecode))
+		assert.Assert(t, errors.Is(LoadEnv((*Configuration)(nil)), ErrDecode))
+		assert.Assert(t, errors.Is(LoadEnv(&map[string]string{}), ErrDecode))
+	})
+}
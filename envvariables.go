@@ -17,9 +17,16 @@
 package configlib
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -29,37 +36,206 @@ type EnvConfig struct {
 	Variable     string
 	DefaultValue string
 	Required     bool
+
+	// Enum lists the allowed values, if not empty.
+	Enum []string
+	// Pattern is a regular expression the value must match, if not empty.
+	Pattern string
+	// Min and Max are the bounds of numeric values, if not nil.
+	Min *float64
+	Max *float64
+	// Format is the format of the value, if not empty: url or duration.
+	Format string
 }
 
-// Deprecated: use a library to handle env variables, such as [env](https://github.com/caarlos0/env).
 // GetEnvVariables extracts configured environment variables and unmarshals them in provided `output` interface.
-func GetEnvVariables(envVariablesConfig []EnvConfig, output interface{}) error {
+// Values, or default values when variables are not set, are checked against the EnvConfig rules
+// before decoding. All the missing, invalid and unparsable variables are reported at once, joined
+// in the returned error, and output is left untouched if any variable is not valid. Entries with
+// an invalid Pattern or an unknown Format are rejected before any variable is read.
+// Variables are read from the process environment, unless the EnvLookup or EnvMap options are given.
+// If the KEY_FILE variable is set, the value is read from the file it names, such as a mounted secret.
+//
+// Deprecated: use LoadEnv instead.
+func GetEnvVariables(envVariablesConfig []EnvConfig, output interface{}, opts ...EnvOption) error {
+	l := newEnvLoader(opts)
+	patterns, err := compileEnvPatterns(envVariablesConfig)
+	if err != nil {
+		return err
+	}
+
 	v := viper.New()
-	v.AutomaticEnv()
-	for _, config := range envVariablesConfig {
-		if err := setViperVariable(v, config); err != nil {
-			return err
+	var errs []error
+	configs := make([]EnvConfig, 0, len(envVariablesConfig))
+	for i, config := range envVariablesConfig {
+		config.Key = l.prefix + config.Key
+		configs = append(configs, config)
+		value, ok, err := lookupEnvFile(config.Key, l.lookup)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		lookup := func(string) (string, bool) { return value, ok }
+		configValue := envConfigValue(config, lookup)
+		if configValue != "" {
+			// values not matching the schema types are not decoded, so that they are reported once
+			if err := l.addSchemaValue(strings.Split(config.Variable, "."), config.Key, configValue, defaultEnvSeparator); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if err := setViperVariable(v, config, lookup); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if configValue != "" {
+			for _, err := range checkEnvRules(config, patterns[i], configValue) {
+				errs = append(errs, markError(ErrValidation, fmt.Errorf("env variable %s: %w", config.Key, err)))
+			}
 		}
 	}
+	if err := l.validateSchema(); err != nil {
+		errs = append(errs, err)
+	}
 
-	if err := v.UnmarshalExact(&output); err != nil {
-		return fmt.Errorf("unable to decode into struct: %s", err.Error())
+	// decode into a copy, so that output is not partially set on errors
+	target := output
+	outputValue := reflect.ValueOf(output)
+	if outputValue.Kind() == reflect.Pointer && !outputValue.IsNil() {
+		copied := reflect.New(outputValue.Type().Elem())
+		copied.Elem().Set(outputValue.Elem())
+		target = copied.Interface()
+	}
+	if err := v.UnmarshalExact(&target); err != nil {
+		errs = append(errs, envDecodeErrors(err, configs)...)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if target != output {
+		outputValue.Elem().Set(reflect.ValueOf(target).Elem())
 	}
 	return nil
 }
 
-func setViperVariable(v *viper.Viper, env EnvConfig) error {
-	if err := v.BindEnv(env.Variable, env.Key); err != nil {
-		return fmt.Errorf("Error binding env variable %s", env.Key)
+// envDecodeErrors splits the error returned decoding the env variables, reporting the
+// env variable each error refers to.
+func envDecodeErrors(err error, envVariablesConfig []EnvConfig) []error {
+	var mapstructureErr *mapstructure.Error
+	if !errors.As(err, &mapstructureErr) {
+		return []error{markError(ErrDecode, fmt.Errorf("unable to decode into struct: %w", err))}
 	}
+
+	envKey := func(variable string) string {
+		for _, config := range envVariablesConfig {
+			if strings.EqualFold(config.Variable, variable) {
+				return config.Key
+			}
+		}
+		return variable
+	}
+	errs := make([]error, 0, len(mapstructureErr.Errors))
+	for _, message := range mapstructureErr.Errors {
+		if match := decodeInvalidKeys.FindStringSubmatch(message); match != nil {
+			for _, variable := range strings.Split(match[2], ", ") {
+				if match[1] != "" {
+					variable = match[1] + "." + variable
+				}
+				errs = append(errs, markError(ErrDecode, fmt.Errorf("env variable %s: output has no field %s", envKey(variable), variable)))
+			}
+			continue
+		}
+		if match := decodeErrorName.FindStringSubmatch(message); match != nil {
+			errs = append(errs, markError(ErrDecode, fmt.Errorf("env variable %s: %s", envKey(match[1]), message)))
+			continue
+		}
+		errs = append(errs, markError(ErrDecode, fmt.Errorf("unable to decode into struct: %s", message)))
+	}
+	return errs
+}
+
+func setViperVariable(v *viper.Viper, env EnvConfig, lookup func(key string) (string, bool)) error {
 	if env.DefaultValue != "" {
 		v.SetDefault(env.Variable, env.DefaultValue)
 	}
-	if env.Required {
-		_, ok := os.LookupEnv(env.Key)
-		if !ok {
-			return fmt.Errorf("required env variable %s not set", env.Key)
-		}
+	if _, ok := lookup(env.Key); env.Required && !ok {
+		return markError(ErrMissingEnv, fmt.Errorf("required env variable %s not set", env.Key))
+	}
+	// as viper does with the bound env variables, empty values are considered not set
+	if value, _ := lookup(env.Key); value != "" {
+		v.Set(env.Variable, value)
 	}
 	return nil
 }
+
+// envConfigValue returns the value of the env variable, or its default value if it is not set.
+func envConfigValue(env EnvConfig, lookup func(key string) (string, bool)) string {
+	if value, _ := lookup(env.Key); value != "" {
+		return value
+	}
+	return env.DefaultValue
+}
+
+// compileEnvPatterns compiles the Pattern of each entry, returning nil for the entries without it.
+// Invalid patterns and unknown formats are reported as errors of the entries, rather than of
+// the values of their variables.
+func compileEnvPatterns(envVariablesConfig []EnvConfig) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(envVariablesConfig))
+	var errs []error
+	for i, env := range envVariablesConfig {
+		if env.Pattern != "" {
+			pattern, err := regexp.Compile(env.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("env config %s: invalid pattern %q: %w", env.Key, env.Pattern, err))
+			}
+			patterns[i] = pattern
+		}
+		if env.Format != "" && env.Format != "url" && env.Format != "duration" {
+			errs = append(errs, fmt.Errorf("env config %s: unknown format %q", env.Key, env.Format))
+		}
+	}
+	return patterns, errors.Join(errs...)
+}
+
+// checkEnvRules returns an error for each rule of env violated by value, where pattern is
+// the compiled Pattern of env.
+func checkEnvRules(env EnvConfig, pattern *regexp.Regexp, value string) []error {
+	var errs []error
+	if len(env.Enum) > 0 && !containsString(env.Enum, value) {
+		errs = append(errs, fmt.Errorf("enum: value %q is not one of %s", value, quoteJoin(env.Enum, ", ")))
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		errs = append(errs, fmt.Errorf("pattern: value %q does not match %q", value, env.Pattern))
+	}
+	if env.Min != nil || env.Max != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("min/max: value %q is not a number", value))
+		case env.Min != nil && number < *env.Min:
+			errs = append(errs, fmt.Errorf("min: value %s is less than %v", value, *env.Min))
+		case env.Max != nil && number > *env.Max:
+			errs = append(errs, fmt.Errorf("max: value %s is greater than %v", value, *env.Max))
+		}
+	}
+	switch env.Format {
+	case "url":
+		if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("format: value %q is not a valid url", value))
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			errs = append(errs, fmt.Errorf("format: value %q is not a valid duration", value))
+		}
+	}
+	return errs
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
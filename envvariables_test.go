@@ -17,6 +17,7 @@
 package configlib
 
 import (
+	"errors"
 	"os"
 	"testing"
 
@@ -129,9 +130,154 @@ func TestGetEnvVariables(t *testing.T) {
 
 		assert.Assert(t, err != nil, "Get env variables not errored.")
 		assert.Equal(t, err.Error(), "required env variable MY_ENV not set", "Get env variables not errored.")
+		assert.Assert(t, errors.Is(err, ErrMissingEnv), "Get env variables not errored with missing env.")
 		assert.Equal(t, env, MyEnvDef{}, "Not returns value.")
 	})
 
+	t.Run("returns all the missing and unparsable variables at once", func(t *testing.T) {
+		type MyEnvDef struct {
+			First  string
+			Second string
+			Port   int
+			Debug  bool
+		}
+
+		var env MyEnvDef
+		envConfig := []EnvConfig{
+			{Key: "MY_FIRST_ENV", Variable: "First", Required: true},
+			{Key: "MY_SECOND_ENV", Variable: "Second", Required: true},
+			{Key: "MY_PORT_ENV", Variable: "Port"},
+			{Key: "MY_DEBUG_ENV", Variable: "Debug", DefaultValue: "true"},
+		}
+		testSetEnv(t, "MY_PORT_ENV", "not-a-port")
+		defer testUnsetEnv(t, "MY_PORT_ENV")
+
+		err := GetEnvVariables(envConfig, &env)
+
+		assert.Assert(t, err != nil, "Get env variables not errored.")
+		assert.Assert(t, errors.Is(err, ErrMissingEnv), "Get env variables not errored with missing env.")
+		assert.Assert(t, errors.Is(err, ErrDecode), "Get env variables not errored with decode error.")
+		assert.ErrorContains(t, err, "required env variable MY_FIRST_ENV not set\nrequired env variable MY_SECOND_ENV not set\nenv variable MY_PORT_ENV: cannot parse 'Port' as int")
+		assert.Equal(t, env, MyEnvDef{}, "Not returns value.")
+	})
+
+	t.Run("reads env variables from the given map", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Name string
+			Port int
+		}
+
+		var env MyEnvDef
+		envConfig := []EnvConfig{
+			{Key: "NAME", Variable: "Name", Required: true},
+			{Key: "PORT", Variable: "Port", DefaultValue: "3000"},
+			{Key: "EMPTY", Variable: "Port"},
+		}
+
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{"APP_NAME": "my-service", "APP_EMPTY": ""}), EnvPrefix("APP_"))
+
+		assert.Equal(t, err, nil, "Error getting values.")
+		assert.Equal(t, env, MyEnvDef{Name: "my-service", Port: 3000})
+	})
+
+	t.Run("keeps the output fields not set by env variables", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Name  string
+			Other string
+		}
+
+		env := MyEnvDef{Other: "preset"}
+		envConfig := []EnvConfig{
+			{Key: "NAME", Variable: "Name", Required: true},
+		}
+
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{"NAME": "my-service"}))
+
+		assert.Equal(t, err, nil, "Error getting values.")
+		assert.Equal(t, env, MyEnvDef{Name: "my-service", Other: "preset"})
+	})
+
+	t.Run("returns the violated rules of each variable", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Level    string
+			Port     int
+			Endpoint string
+			Timeout  string
+			Name     string
+		}
+
+		minPort, maxPort := 1.0, 65535.0
+		var env MyEnvDef
+		envConfig := []EnvConfig{
+			{Key: "LEVEL", Variable: "Level", Enum: []string{"debug", "info"}, DefaultValue: "trace"},
+			{Key: "PORT", Variable: "Port", Min: &minPort, Max: &maxPort},
+			{Key: "ENDPOINT", Variable: "Endpoint", Format: "url"},
+			{Key: "TIMEOUT", Variable: "Timeout", Format: "duration"},
+			{Key: "NAME", Variable: "Name", Pattern: "^[a-z-]+$"},
+		}
+
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{
+			"PORT":     "70000",
+			"ENDPOINT": "not a url",
+			"TIMEOUT":  "10",
+			"NAME":     "My Service",
+		}))
+
+		assert.Assert(t, errors.Is(err, ErrValidation), "Get env variables not errored with validation error.")
+		assert.Error(t, err, `env variable LEVEL: enum: value "trace" is not one of "debug", "info"
+env variable PORT: max: value 70000 is greater than 65535
+env variable ENDPOINT: format: value "not a url" is not a valid url
+env variable TIMEOUT: format: value "10" is not a valid duration
+env variable NAME: pattern: value "My Service" does not match "^[a-z-]+$"`)
+		assert.Equal(t, env, MyEnvDef{}, "Not returns value.")
+	})
+
+	t.Run("throws a configuration error for invalid rules", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Name  string
+			Level string
+		}
+
+		env := MyEnvDef{Name: "unchanged"}
+		envConfig := []EnvConfig{
+			{Key: "NAME", Variable: "Name", Pattern: "^[a-z"},
+			{Key: "LEVEL", Variable: "Level", Format: "email"},
+		}
+
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{}))
+
+		assert.Assert(t, err != nil, "Get env variables not errored.")
+		assert.Assert(t, !errors.Is(err, ErrValidation), "Invalid rules are reported as validation errors.")
+		assert.Error(t, err, "env config NAME: invalid pattern \"^[a-z\": error parsing regexp: missing closing ]: `[a-z`\nenv config LEVEL: unknown format \"email\"")
+		assert.Equal(t, env, MyEnvDef{Name: "unchanged"}, "Not returns value.")
+	})
+
+	t.Run("returns variables satisfying their rules", func(t *testing.T) {
+		t.Parallel()
+		type MyEnvDef struct {
+			Level    string
+			Port     int
+			Endpoint string
+		}
+
+		minPort := 1.0
+		var env MyEnvDef
+		envConfig := []EnvConfig{
+			{Key: "LEVEL", Variable: "Level", Enum: []string{"debug", "info"}, DefaultValue: "info"},
+			{Key: "PORT", Variable: "Port", Min: &minPort, Pattern: "^[0-9]+$"},
+			{Key: "ENDPOINT", Variable: "Endpoint", Format: "url"},
+		}
+
+		err := GetEnvVariables(envConfig, &env, EnvMap(map[string]string{"PORT": "8080"}))
+
+		assert.Equal(t, err, nil, "Error getting values.")
+		assert.Equal(t, env, MyEnvDef{Level: "info", Port: 8080})
+	})
+
 	t.Run("throw if output struct does not contain config variable", func(t *testing.T) {
 		type MyEnvDef struct{}
 
@@ -148,6 +294,7 @@ func TestGetEnvVariables(t *testing.T) {
 		err := GetEnvVariables(envConfig, &env)
 
 		assert.Assert(t, err != nil, "Get env variables not errored.")
+		assert.Equal(t, err.Error(), "env variable MY_ENV: output has no field myenv")
 		assert.Equal(t, env, MyEnvDef{}, "Not returns value.")
 	})
 
@@ -192,7 +339,7 @@ func TestSetViperVariables(t *testing.T) {
 			Key:      "MY_REQUIRED_TEST_KEY",
 			Variable: "variableKey",
 			Required: true,
-		})
+		}, mapLookup(map[string]string{}))
 		assert.Assert(t, err != nil, "Set viper variable not throw if required variable does not exist.")
 		assert.Equal(t, err.Error(), "required env variable MY_REQUIRED_TEST_KEY not set", "Set variable error message is not correct")
 	})
@@ -202,12 +349,11 @@ func TestSetViperVariables(t *testing.T) {
 		const key = "ENV_KEY"
 		const defaultValue = "value"
 		const variableKey = "variableKey"
-		testUnsetEnv(t, key)
 		err := setViperVariable(v, EnvConfig{
 			Key:          key,
 			Variable:     variableKey,
 			DefaultValue: defaultValue,
-		})
+		}, mapLookup(map[string]string{}))
 		assert.Equal(t, err, nil, "set env variable does not return error")
 		assert.Equal(t, v.GetString(variableKey), defaultValue, "Get a not correct variable.")
 	})
@@ -217,14 +363,19 @@ func TestSetViperVariables(t *testing.T) {
 		const variableKey = "variableKey"
 		const key = "MY_REQUIRED_TEST_KEY"
 		const customValue = "my-custom-value"
-		testSetEnv(t, key, customValue)
-		defer testUnsetEnv(t, key)
 		err := setViperVariable(v, EnvConfig{
 			Key:          key,
 			Variable:     variableKey,
 			DefaultValue: "value",
-		})
+		}, mapLookup(map[string]string{key: customValue}))
 		assert.Equal(t, err, nil, "set env variable does not return error")
 		assert.Equal(t, v.GetString(variableKey), customValue, "Get a not correct variable.")
 	})
 }
+
+func mapLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	// ErrConfigNotFound is returned when a config file does not exist.
+	ErrConfigNotFound = errors.New("config not found")
+	// ErrInvalidSchema is returned when the json schema can not be read or it is not a valid schema.
+	ErrInvalidSchema = errors.New("invalid json schema")
+	// ErrValidation is returned when the configuration does not satisfy the json schema.
+	ErrValidation = errors.New("configuration not valid")
+	// ErrDecode is returned when a config file can not be parsed or the configuration
+	// can not be decoded into the output.
+	ErrDecode = errors.New("configuration decode failed")
+	// ErrMissingEnv is returned when a required env variable is not set.
+	ErrMissingEnv = errors.New("required env variable not set")
+)
+
+// markedError is an error matching a sentinel error with errors.Is, while keeping its own message
+// and wrapping its cause.
+type markedError struct {
+	sentinel error
+	err      error
+}
+
+// markError marks err so that errors.Is reports it matches sentinel.
+func markError(sentinel, err error) error {
+	return &markedError{sentinel: sentinel, err: err}
+}
+
+func (e *markedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *markedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *markedError) Unwrap() error {
+	return e.err
+}
+
+// FieldError describes a json schema violation of a configuration field.
+type FieldError struct {
+	// Pointer is the JSON Pointer (RFC 6901) of the invalid field, empty for the document root.
+	Pointer string
+	// Keyword is the json schema keyword the field violates, such as type, required or maximum.
+	Keyword string
+	// Expected is the constraint set by the keyword, such as the expected type or the maximum value.
+	Expected interface{}
+	// Actual is the value of the field, or its type for type violations.
+	Actual interface{}
+	// Message is the human readable description of the violation.
+	Message string
+	// Position is where the field is set, if known. For missing fields it is the
+	// position of their parent.
+	Position Position
+}
+
+func (e FieldError) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "(root)"
+	}
+	if e.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", e.Position, pointer, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", pointer, e.Message)
+}
+
+// ValidationError is returned when the configuration does not satisfy the json schema.
+// It holds an error for each violation.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		messages = append(messages, fieldError.Error())
+	}
+	return fmt.Sprintf("json schema validation errors: %s", strings.Join(messages, "; "))
+}
+
+// Is reports whether target is ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// DecodeError is a field of the configuration document that can not be decoded into the output.
+type DecodeError struct {
+	// Pointer is the JSON Pointer (RFC 6901) of the field, empty for the document root.
+	Pointer string
+	// Position is where the field is set, if known.
+	Position Position
+	// Message is the human readable description of the error.
+	Message string
+	// Suggestions are the output fields closest to an unknown key, the likely
+	// intended names when the key is a typo.
+	Suggestions []string
+}
+
+func (e *DecodeError) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "(root)"
+	}
+	if e.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", e.Position, pointer, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", pointer, e.Message)
+}
+
+// Is reports whether target is ErrDecode.
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+var (
+	decodeErrorName   = regexp.MustCompile(`^(?:cannot parse |error decoding )?'([^']*)'`)
+	decodeInvalidKeys = regexp.MustCompile(`^'([^']*)' has invalid keys: (.*)$`)
+)
+
+// newDecodeErrors converts the errors returned by mapstructure into DecodeErrors, reporting
+// the position of the fields and suggesting the fields of outputType closest to the unknown keys.
+// Errors not referring to a field are returned as they are.
+func newDecodeErrors(err error, positions map[string]Position, outputType reflect.Type) error {
+	var mapstructureErr *mapstructure.Error
+	if !errors.As(err, &mapstructureErr) {
+		return err
+	}
+
+	decodeErrors := make([]error, 0, len(mapstructureErr.Errors))
+	for _, message := range mapstructureErr.Errors {
+		if match := decodeInvalidKeys.FindStringSubmatch(message); match != nil {
+			pointer := decodeNameToPointer(match[1])
+			for _, key := range strings.Split(match[2], ", ") {
+				keyPointer := pointer + "/" + escapeJSONPointerToken(key)
+				decodeErr := newDecodeError(keyPointer, "unknown key", positions)
+				if decodeErr.Suggestions = suggestKeys(outputType, keyPointer); len(decodeErr.Suggestions) > 0 {
+					decodeErr.Message = fmt.Sprintf("unknown key, did you mean %s?", quoteJoin(decodeErr.Suggestions, " or "))
+				}
+				decodeErrors = append(decodeErrors, decodeErr)
+			}
+			continue
+		}
+		if match := decodeErrorName.FindStringSubmatch(message); match != nil {
+			decodeErrors = append(decodeErrors, newDecodeError(decodeNameToPointer(match[1]), message, positions))
+			continue
+		}
+		decodeErrors = append(decodeErrors, errors.New(message))
+	}
+	if len(decodeErrors) == 1 {
+		return decodeErrors[0]
+	}
+	return errors.Join(decodeErrors...)
+}
+
+func newDecodeError(pointer, message string, positions map[string]Position) *DecodeError {
+	position, _ := lookupPosition(positions, pointer)
+	return &DecodeError{Pointer: pointer, Position: position, Message: message}
+}
+
+func quoteJoin(values []string, separator string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", value))
+	}
+	return strings.Join(quoted, separator)
+}
+
+// decodeNameToPointer converts a mapstructure field name, such as db.hosts[0] or labels[key],
+// into a JSON Pointer.
+func decodeNameToPointer(name string) string {
+	var tokens []string
+	for _, part := range strings.Split(name, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			tokens = append(tokens, key)
+		}
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			tokens = append(tokens, index)
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return toJSONPointer(tokens)
+}
+
+// schemaKeywords maps the gojsonschema error types to the json schema keywords.
+var schemaKeywords = map[string]string{
+	"false":                           "false",
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// expectedDetails lists, for each gojsonschema error type, the detail holding the expected constraint.
+var expectedDetails = map[string]string{
+	"invalid_type":         "expected",
+	"missing_dependency":   "dependency",
+	"const":                "allowed",
+	"enum":                 "allowed",
+	"array_min_items":      "min",
+	"array_max_items":      "max",
+	"array_min_properties": "min",
+	"array_max_properties": "max",
+	"string_gte":           "min",
+	"string_lte":           "max",
+	"pattern":              "pattern",
+	"format":               "format",
+	"multiple_of":          "multiple",
+	"number_gte":           "min",
+	"number_gt":            "min",
+	"number_lte":           "max",
+	"number_lt":            "max",
+}
+
+func newValidationError(resultErrors []gojsonschema.ResultError) *ValidationError {
+	validationError := &ValidationError{Errors: make([]FieldError, 0, len(resultErrors))}
+	for _, resultError := range resultErrors {
+		validationError.Errors = append(validationError.Errors, newFieldError(resultError))
+	}
+	return validationError
+}
+
+func newFieldError(resultError gojsonschema.ResultError) FieldError {
+	errorType := resultError.Type()
+	details := resultError.Details()
+
+	tokens := strings.Split(resultError.Context().String("\x00"), "\x00")[1:]
+	if property, ok := details["property"].(string); ok && (errorType == "required" || errorType == "additional_property_not_allowed") {
+		tokens = append(tokens, property)
+	}
+
+	keyword, ok := schemaKeywords[errorType]
+	if !ok {
+		keyword = errorType
+	}
+
+	var actual interface{} = resultError.Value()
+	if errorType == "invalid_type" {
+		actual = details["given"]
+	}
+	if errorType == "required" {
+		actual = nil
+	}
+
+	var expected interface{}
+	if detail, ok := expectedDetails[errorType]; ok {
+		expected = details[detail]
+	}
+	switch value := expected.(type) {
+	case *big.Float:
+		expected, _ = value.Float64()
+	case fmt.Stringer:
+		expected = value.String()
+	}
+
+	return FieldError{
+		Pointer:  toJSONPointer(tokens),
+		Keyword:  keyword,
+		Expected: expected,
+		Actual:   actual,
+		Message:  resultError.Description(),
+	}
+}
+
+func toJSONPointer(tokens []string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(escapeJSONPointerToken(token))
+	}
+	return sb.String()
+}
+
+func escapeJSONPointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
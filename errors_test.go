@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestValidationError(t *testing.T) {
+	jsonSchema := []byte(`{
+		"type": "object",
+		"properties": {
+			"db": {
+				"type": "object",
+				"properties": {
+					"host": {"type": "string"},
+					"pool": {
+						"type": "object",
+						"properties": {"size": {"type": "integer", "maximum": 100}}
+					}
+				},
+				"required": ["user"]
+			},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}},
+			"a/b~c": {"type": "string", "pattern": "^[a-z]+$"}
+		},
+		"additionalProperties": false
+	}`)
+
+	t.Run("exposes an error for each violated field", func(t *testing.T) {
+		err := validateJSONConfig(jsonSchema, []byte(`{
+			"db": {"host": 12, "pool": {"size": 200}},
+			"tags": ["a", "c"],
+			"a/b~c": "ABC",
+			"unknown": true
+		}`))
+
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+
+		fieldErrors := map[string]FieldError{}
+		for _, fieldError := range validationErr.Errors {
+			fieldErrors[fieldError.Pointer] = fieldError
+		}
+		assert.Equal(t, len(fieldErrors), 6, "%v", validationErr.Errors)
+		assert.DeepEqual(t, fieldErrors["/db/host"], FieldError{
+			Pointer:  "/db/host",
+			Keyword:  "type",
+			Expected: "string",
+			Actual:   "integer",
+			Message:  "Invalid type. Expected: string, given: integer",
+		})
+		assert.DeepEqual(t, fieldErrors["/db/pool/size"], FieldError{
+			Pointer:  "/db/pool/size",
+			Keyword:  "maximum",
+			Expected: float64(100),
+			Actual:   fieldErrors["/db/pool/size"].Actual,
+			Message:  "Must be less than or equal to 100",
+		})
+		assert.Equal(t, fieldErrors["/db/user"].Keyword, "required")
+		assert.Equal(t, fieldErrors["/db/user"].Actual, nil)
+		assert.Equal(t, fieldErrors["/tags/1"].Keyword, "enum")
+		assert.Equal(t, fieldErrors["/tags/1"].Actual, "c")
+		assert.Equal(t, fieldErrors["/a~1b~0c"].Keyword, "pattern")
+		assert.Equal(t, fieldErrors["/a~1b~0c"].Expected, "^[a-z]+$")
+		assert.Equal(t, fieldErrors["/unknown"].Keyword, "additionalProperties")
+	})
+
+	t.Run("reports root violations with empty pointer", func(t *testing.T) {
+		err := validateJSONConfig([]byte(`{"type": "string"}`), []byte(`{}`))
+
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Equal(t, len(validationErr.Errors), 1)
+		assert.Equal(t, validationErr.Errors[0].Pointer, "")
+		assert.Equal(t, err.Error(), "json schema validation errors: (root): Invalid type. Expected: string, given: object")
+	})
+
+	t.Run("is returned by GetConfigFromFile", func(t *testing.T) {
+		var config map[string]interface{}
+		err := GetConfigFromFile("test-config.test", ".", []byte(`{
+			"additionalProperties": {"properties": {"kint": {"maximum": 50}}}
+		}`), &config)
+
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Equal(t, len(validationErr.Errors), 1)
+		assert.Equal(t, validationErr.Errors[0].Pointer, "/CamelCaseKey/kint")
+		assert.Equal(t, validationErr.Errors[0].Position, Position{File: "test-config.test.json", Line: 42, Column: 5})
+		assert.Equal(t, err.Error(), "configuration not valid: json schema validation errors: test-config.test.json:42:5: /CamelCaseKey/kint: Must be less than or equal to 50")
+	})
+}
+
+func TestSentinelErrors(t *testing.T) {
+	t.Run("config not found", func(t *testing.T) {
+		var config map[string]interface{}
+		err := NewLoader(WithFile("test-config.test", "."), WithSources(JSONPatchSource("missing", "."))).Load(context.Background(), &config)
+		assert.Assert(t, errors.Is(err, ErrConfigNotFound), "Error is not ErrConfigNotFound: %v", err)
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist), "Error does not wrap fs.ErrNotExist: %v", err)
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		var config map[string]interface{}
+		err := GetConfigFromFile("test-config.test", ".", []byte(`{not json`), &config)
+		assert.Assert(t, errors.Is(err, ErrInvalidSchema), "Error is not ErrInvalidSchema: %v", err)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		var config map[string]interface{}
+		err := GetConfigFromFile("test-config.test", ".", []byte(`{"type": "array"}`), &config)
+		assert.Assert(t, errors.Is(err, ErrValidation), "Error is not ErrValidation: %v", err)
+		assert.Assert(t, !errors.Is(err, ErrDecode), "Error is ErrDecode: %v", err)
+	})
+
+	t.Run("decode of a malformed file", func(t *testing.T) {
+		var config map[string]interface{}
+		err := NewLoader(WithFS(fstest.MapFS{
+			"config.json": &fstest.MapFile{Data: []byte(`{"a": }`)},
+		}), WithFile("config", ".")).Load(context.Background(), &config)
+		assert.Assert(t, errors.Is(err, ErrDecode), "Error is not ErrDecode: %v", err)
+		var syntaxErr *json.SyntaxError
+		assert.Assert(t, errors.As(err, &syntaxErr), "Error does not wrap the json syntax error: %v", err)
+	})
+
+	t.Run("missing env", func(t *testing.T) {
+		var env struct{ MyEnv string }
+		err := GetEnvVariables([]EnvConfig{{Key: "MY_MISSING_SENTINEL_ENV", Variable: "MyEnv", Required: true}}, &env)
+		assert.Assert(t, errors.Is(err, ErrMissingEnv), "Error is not ErrMissingEnv: %v", err)
+	})
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// JSONCParser is a lenient koanf parser for json documents. On top of plain json it accepts
+// `//` and `/* */` comments, trailing commas in objects and arrays, single quoted strings and
+// unquoted object keys made of letters, digits, `_`, `$` and `-`.
+// Numbers are decoded as float64, as the json parser does.
+//
+// It is registered for the jsonc extension; .json files are read with it by the loaders
+// created with the WithLenientJSON option.
+type JSONCParser struct{}
+
+// SyntaxError is returned when a document cannot be parsed, reporting where the error occurred.
+// The File of the position is set when the document is read from a config file.
+type SyntaxError struct {
+	Position
+	Msg string
+	// Err is the error returned by the underlying parser, if any.
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.File == "" && e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Position, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Unmarshal parses the given json bytes.
+func (JSONCParser) Unmarshal(b []byte) (map[string]interface{}, error) {
+	return parseJSONC(b, nil)
+}
+
+// Positions returns the position of the keys and of the array items of the given json bytes.
+func (JSONCParser) Positions(b []byte) (map[string]Position, error) {
+	positions := map[string]Position{}
+	if _, err := parseJSONC(b, positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// parseJSONC parses the given bytes, recording the positions of the values when positions is not nil.
+func parseJSONC(b []byte, positions map[string]Position) (map[string]interface{}, error) {
+	p := &jsoncParser{data: b, line: 1, column: 1, positions: positions}
+	if err := p.skipSpaces(); err != nil {
+		return nil, err
+	}
+	if p.peek() != '{' {
+		return nil, p.errorf("expected object at document root")
+	}
+	p.record("")
+	value, err := p.parseValue("")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skipSpaces(); err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected character %q after document end", p.peek())
+	}
+	return value.(map[string]interface{}), nil
+}
+
+// Marshal marshals the given config map to plain json bytes.
+func (JSONCParser) Marshal(o map[string]interface{}) ([]byte, error) {
+	return json.Marshal(o)
+}
+
+type jsoncParser struct {
+	data      []byte
+	offset    int
+	line      int
+	column    int
+	positions map[string]Position
+}
+
+// record saves the current position as the position of the value at pointer.
+func (p *jsoncParser) record(pointer string) {
+	if p.positions != nil {
+		p.positions[pointer] = Position{Line: p.line, Column: p.column}
+	}
+}
+
+func (p *jsoncParser) eof() bool {
+	return p.offset >= len(p.data)
+}
+
+func (p *jsoncParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.offset]
+}
+
+func (p *jsoncParser) next() byte {
+	c := p.data[p.offset]
+	p.offset++
+	if c == '\n' {
+		p.line++
+		p.column = 1
+	} else if c < utf8.RuneSelf || utf8.RuneStart(c) {
+		p.column++
+	}
+	return c
+}
+
+func (p *jsoncParser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Position: Position{Line: p.line, Column: p.column}, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *jsoncParser) unexpected() error {
+	if p.eof() {
+		return p.errorf("unexpected end of document")
+	}
+	return p.errorf("unexpected character %q", p.peek())
+}
+
+// skipSpaces skips whitespaces and comments.
+func (p *jsoncParser) skipSpaces() error {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.next()
+		case c == '/' && p.offset+1 < len(p.data) && p.data[p.offset+1] == '/':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case c == '/' && p.offset+1 < len(p.data) && p.data[p.offset+1] == '*':
+			line, column := p.line, p.column
+			p.next()
+			p.next()
+			for !bytes.HasPrefix(p.data[p.offset:], []byte("*/")) {
+				if p.eof() {
+					return &SyntaxError{Position: Position{Line: line, Column: column}, Msg: "unterminated comment"}
+				}
+				p.next()
+			}
+			p.next()
+			p.next()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *jsoncParser) parseValue(pointer string) (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject(pointer)
+	case c == '[':
+		return p.parseArray(pointer)
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentifierStart(c):
+		line, column := p.line, p.column
+		switch identifier := p.parseIdentifier(); identifier {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return nil, &SyntaxError{Position: Position{Line: line, Column: column}, Msg: fmt.Sprintf("invalid value %q", identifier)}
+		}
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *jsoncParser) parseObject(pointer string) (interface{}, error) {
+	object := map[string]interface{}{}
+	p.next()
+	for {
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '}' {
+			p.next()
+			return object, nil
+		}
+
+		line, column := p.line, p.column
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			var err error
+			if key, err = p.parseString(); err != nil {
+				return nil, err
+			}
+		case isIdentifierStart(c):
+			key = p.parseIdentifier()
+		default:
+			return nil, p.unexpected()
+		}
+
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ':' {
+			return nil, p.errorf("expected ':' after object key %q", key)
+		}
+		p.next()
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		keyPointer := pointer + "/" + escapeJSONPointerToken(key)
+		if p.positions != nil {
+			p.positions[keyPointer] = Position{Line: line, Column: column}
+		}
+		value, err := p.parseValue(keyPointer)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = value
+
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *jsoncParser) parseArray(pointer string) (interface{}, error) {
+	array := []interface{}{}
+	p.next()
+	for {
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			p.next()
+			return array, nil
+		}
+
+		itemPointer := fmt.Sprintf("%s/%d", pointer, len(array))
+		p.record(itemPointer)
+		value, err := p.parseValue(itemPointer)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		if err := p.skipSpaces(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *jsoncParser) parseString() (string, error) {
+	quote := p.next()
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch {
+		case c == quote:
+			p.next()
+			return sb.String(), nil
+		case c == '\n':
+			return "", p.errorf("unexpected new line in string")
+		case c < ' ':
+			return "", p.errorf("invalid control character %q in string", c)
+		case c == '\\':
+			r, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte(p.next())
+		}
+	}
+}
+
+func (p *jsoncParser) parseEscape() (rune, error) {
+	p.next()
+	if p.eof() {
+		return 0, p.errorf("unterminated string")
+	}
+	switch c := p.next(); c {
+	case '"', '\'', '\\', '/':
+		return rune(c), nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		r, err := p.parseHexRune()
+		if err != nil {
+			return 0, err
+		}
+		if utf16.IsSurrogate(r) && bytes.HasPrefix(p.data[p.offset:], []byte(`\u`)) {
+			p.next()
+			p.next()
+			low, err := p.parseHexRune()
+			if err != nil {
+				return 0, err
+			}
+			return utf16.DecodeRune(r, low), nil
+		}
+		return r, nil
+	default:
+		return 0, p.errorf("invalid escape character %q", c)
+	}
+}
+
+func (p *jsoncParser) parseHexRune() (rune, error) {
+	if p.offset+4 > len(p.data) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	value, err := strconv.ParseUint(string(p.data[p.offset:p.offset+4]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	for i := 0; i < 4; i++ {
+		p.next()
+	}
+	return rune(value), nil
+}
+
+func (p *jsoncParser) parseNumber() (interface{}, error) {
+	line, column := p.line, p.column
+	start := p.offset
+	for !p.eof() && strings.IndexByte("+-0123456789.eE", p.peek()) >= 0 {
+		p.next()
+	}
+	literal := string(p.data[start:p.offset])
+	if !json.Valid([]byte(literal)) {
+		return nil, &SyntaxError{Position: Position{Line: line, Column: column}, Msg: fmt.Sprintf("invalid number %q", literal)}
+	}
+	value, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, &SyntaxError{Position: Position{Line: line, Column: column}, Msg: fmt.Sprintf("invalid number %q", literal)}
+	}
+	return value, nil
+}
+
+func (p *jsoncParser) parseIdentifier() string {
+	start := p.offset
+	for !p.eof() && isIdentifierPart(p.peek()) {
+		p.next()
+	}
+	return string(p.data[start:p.offset])
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestJSONCParser(t *testing.T) {
+	t.Run("parses plain json as the json parser", func(t *testing.T) {
+		out, err := JSONCParser{}.Unmarshal([]byte(`{"a": {"b": [1, 2.5, "cè\n"], "d": null, "e": false}}`))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, out, map[string]interface{}{
+			"a": map[string]interface{}{
+				"b": []interface{}{float64(1), 2.5, "cè\n"},
+				"d": nil,
+				"e": false,
+			},
+		})
+	})
+
+	t.Run("accepts comments, trailing commas, single quotes and unquoted keys", func(t *testing.T) {
+		out, err := JSONCParser{}.Unmarshal([]byte(`{
+			// line comment
+			unquoted-key: 'single \'quoted\'', /* block comment */
+			"list": [1, 2,],
+			$nested_1: {a: true,},
+		}`))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, out, map[string]interface{}{
+			"unquoted-key": "single 'quoted'",
+			"list":         []interface{}{float64(1), float64(2)},
+			"$nested_1":    map[string]interface{}{"a": true},
+		})
+	})
+
+	testCases := []struct {
+		name     string
+		document string
+		line     int
+		column   int
+		message  string
+	}{
+		{
+			name:     "missing colon",
+			document: "{\n  \"a\" 1\n}",
+			line:     2,
+			column:   7,
+			message:  `expected ':' after object key "a"`,
+		},
+		{
+			name:     "unknown value",
+			document: "{\n  a: yes\n}",
+			line:     2,
+			column:   6,
+			message:  `invalid value "yes"`,
+		},
+		{
+			name:     "invalid number",
+			document: "{a: 01}",
+			line:     1,
+			column:   5,
+			message:  `invalid number "01"`,
+		},
+		{
+			name:     "unterminated comment",
+			document: "{\n /* comment\n}",
+			line:     2,
+			column:   2,
+			message:  "unterminated comment",
+		},
+		{
+			name:     "missing closing brace",
+			document: "{a: 1,\n",
+			line:     2,
+			column:   1,
+			message:  "unexpected end of document",
+		},
+		{
+			name:     "root is not an object",
+			document: "[1]",
+			line:     1,
+			column:   1,
+			message:  "expected object at document root",
+		},
+		{
+			name:     "content after document end",
+			document: "{} {}",
+			line:     1,
+			column:   4,
+			message:  `unexpected character '{' after document end`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run("throws with position if "+testCase.name, func(t *testing.T) {
+			_, err := JSONCParser{}.Unmarshal([]byte(testCase.document))
+			var syntaxErr *SyntaxError
+			assert.Assert(t, errors.As(err, &syntaxErr), "Error is not a SyntaxError: %v", err)
+			assert.Equal(t, syntaxErr.Line, testCase.line)
+			assert.Equal(t, syntaxErr.Column, testCase.column)
+			assert.Equal(t, syntaxErr.Msg, testCase.message)
+		})
+	}
+}
+
+func TestGetConfigFromJSONCFile(t *testing.T) {
+	type SubConfiguration struct {
+		Kbool         bool                   `koanf:"kbool"`
+		Kstring       string                 `koanf:"kstring"`
+		Kint          int64                  `koanf:"kint"`
+		Kfloat        float64                `koanf:"kfloat"`
+		ArrayOfString []string               `koanf:"array-of-string"`
+		ArrayOfNumber []int64                `koanf:"array-of-number"`
+		Other         map[string]interface{} `koanf:"something"`
+	}
+
+	type Configuration map[string]SubConfiguration
+
+	t.Run("read correctly jsonc configuration and validate with json schema", func(t *testing.T) {
+		var config Configuration
+		jsonSchema := readFile(t, "./config.schema.test.json")
+		err := GetConfigFromFile("test-config-jsonc.test", ".", jsonSchema, &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{
+			"lower-case-key": SubConfiguration{
+				Kbool:         true,
+				Kstring:       "my-string",
+				Kint:          12,
+				Kfloat:        float64(13.50),
+				ArrayOfString: []string{"my", "values"},
+				ArrayOfNumber: []int64{1, 2, 3},
+				Other: map[string]interface{}{
+					"a": "b",
+					"c": "d",
+				},
+			},
+			"CamelCaseKey": SubConfiguration{
+				Kint: 92,
+			},
+		})
+	})
+
+	t.Run("json files are read in lenient mode only by the loaders with WithLenientJSON", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", "{\n  // the service name\n  name: 'my-service',\n}\n")
+
+		type ServiceConfiguration struct {
+			Name string `koanf:"name"`
+		}
+		var config ServiceConfiguration
+		err := NewLoader(WithFile("config", dir), WithLenientJSON()).Load(context.Background(), &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Name, "my-service")
+
+		err = NewLoader(WithFile("config", dir)).Load(context.Background(), &config)
+		assert.Assert(t, errors.Is(err, ErrDecode), "Error is not a decode error: %v", err)
+		err = GetConfigFromFile("config", dir, nil, &config)
+		assert.Assert(t, errors.Is(err, ErrDecode), "Error is not a decode error: %v", err)
+	})
+
+	t.Run("throws reporting line and column of the syntax error", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.jsonc", "{\n  name: 'my-service'\n  port: 3000\n}\n")
+
+		var config map[string]interface{}
+		err := GetConfigFromFile("config", dir, nil, &config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "config.jsonc:3:3: unexpected character 'p'"), err.Error())
+
+		var syntaxErr *SyntaxError
+		assert.Assert(t, errors.As(err, &syntaxErr), "Error is not a SyntaxError: %v", err)
+		assert.Equal(t, syntaxErr.Position, Position{File: path.Join(dir, "config.jsonc"), Line: 3, Column: 3})
+	})
+}
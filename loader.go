@@ -0,0 +1,346 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/knadh/koanf/maps"
+	"github.com/knadh/koanf/v2"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Loader loads a configuration document from its sources, validates it with the json schema
+// and decodes it into an output structure. Create it with NewLoader.
+type Loader struct {
+	fsys            fs.FS
+	sources         []Source
+	jsonSchema      []byte
+	schemaFile      string
+	watchDebounce   time.Duration
+	strict          bool
+	lenientJSON     bool
+	mergeStrategies mergeStrategies
+	environ         func() []string
+}
+
+// Option configures a Loader.
+type Option func(*Loader)
+
+// NewLoader creates a Loader configured with the given options.
+// By default the loader reads files from the os file system and decodes in strict mode.
+func NewLoader(opts ...Option) *Loader {
+	l := &Loader{
+		fsys:          osFS{},
+		strict:        true,
+		environ:       os.Environ,
+		watchDebounce: defaultWatchDebounce,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithSources adds the given sources to the ones the configuration document is built from.
+// Sources are merged in the order they are added: nested maps are merged key by key, while
+// any other value of a source replaces the one set by the sources before it.
+// Base file, environment overlay file, local override file and environment variables can be
+// layered with:
+//
+//	configlib.WithSources(
+//		configlib.FileSource("config", path),
+//		configlib.FileSource("config.production", path),
+//		configlib.OptionalFileSource("config.local", path),
+//		configlib.EnvSource("APP"),
+//	)
+func WithSources(sources ...Source) Option {
+	return func(l *Loader) {
+		l.sources = append(l.sources, sources...)
+	}
+}
+
+// WithFile adds a FileSource to the loader sources.
+func WithFile(configName, configPath string) Option {
+	return WithSources(FileSource(configName, configPath))
+}
+
+// WithSchema sets the json schema used to validate the loaded document.
+func WithSchema(jsonSchema []byte) Option {
+	return func(l *Loader) {
+		l.jsonSchema = jsonSchema
+	}
+}
+
+// WithSchemaFile sets the file the json schema used to validate the loaded document is read from.
+// The file is read from the loader file system at each load, so that a Watcher reloads the
+// configuration when the schema changes too.
+func WithSchemaFile(filePath string) Option {
+	return func(l *Loader) {
+		l.schemaFile = filePath
+	}
+}
+
+// WithStrict sets whether decoding fails when the document contains keys not present
+// in the output structure. Strict mode is enabled by default.
+func WithStrict(strict bool) Option {
+	return func(l *Loader) {
+		l.strict = strict
+	}
+}
+
+// WithLenientJSON reads the .json config files with JSONCParser, accepting comments, trailing
+// commas, single quoted strings and unquoted keys. It only affects the files read by the loader:
+// other loaders, and GetConfigFromFile, keep reading .json files as plain json.
+func WithLenientJSON() Option {
+	return func(l *Loader) {
+		l.lenientJSON = true
+	}
+}
+
+// WithEnvOverlay adds an EnvSource to the loader sources, so that the environment variables
+// starting with prefix override the values of the sources added before it.
+func WithEnvOverlay(prefix string) Option {
+	return WithSources(EnvSource(prefix))
+}
+
+// WithEnvMap sets the env variables read by the env sources, which by default read the
+// process environment. It makes loading independent from the process environment, for instance in tests.
+func WithEnvMap(env map[string]string) Option {
+	return func(l *Loader) {
+		l.environ = func() []string {
+			environ := make([]string, 0, len(env))
+			for name, value := range env {
+				environ = append(environ, name+"="+value)
+			}
+			return environ
+		}
+	}
+}
+
+// WithFS sets the file system config files are read from.
+func WithFS(fsys fs.FS) Option {
+	return func(l *Loader) {
+		l.fsys = fsys
+	}
+}
+
+// Load loads the configuration configured by opts and returns it decoded as a T value.
+// T must be a struct or a map type.
+func Load[T any](ctx context.Context, opts ...Option) (T, error) {
+	output, _, err := loadAs[T](ctx, NewLoader(opts...))
+	return output, err
+}
+
+// loadAs loads the configuration as a T value, returning the configuration document too.
+func loadAs[T any](ctx context.Context, l *Loader) (T, *koanf.Koanf, error) {
+	var output T
+	if kind := reflect.TypeOf(&output).Elem().Kind(); kind != reflect.Struct && kind != reflect.Map {
+		return output, nil, markError(ErrDecode, fmt.Errorf("unsupported config type %T: it must be a struct or a map", output))
+	}
+	k, positions, err := l.loadDocument(ctx)
+	if err == nil {
+		err = l.decode(k, positions, &output)
+	}
+	if err != nil {
+		var zero T
+		return zero, nil, err
+	}
+	return output, k, nil
+}
+
+// Load loads the configuration and decodes it into output, which must be a non nil pointer,
+// or a non nil map that is filled in place.
+func (l *Loader) Load(ctx context.Context, output interface{}) error {
+	k, positions, err := l.loadDocument(ctx)
+	if err != nil {
+		return err
+	}
+	return l.decode(k, positions, output)
+}
+
+// loadDocument builds, and validates, the configuration document. It returns the document
+// along with the position each of its values comes from.
+func (l *Loader) loadDocument(ctx context.Context) (*koanf.Koanf, map[string]Position, error) {
+	var k = koanf.New(".")
+
+	builder, err := l.newDocumentBuilder()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, source := range l.sources {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if patcher, ok := source.(patchSource); ok {
+			if err := patcher.patch(ctx, builder); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		document, positions, err := source.load(ctx, l)
+		if err != nil {
+			return nil, nil, err
+		}
+		builder.merge(document, positions)
+	}
+	if err := k.Load(mapProvider(builder.document), nil); err != nil {
+		return nil, nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if builder.jsonSchema != nil {
+		jsonDocument, err := json.Marshal(k.Raw())
+		if err != nil {
+			return nil, nil, fmt.Errorf("config document stringify failed: %w", err)
+		}
+		err = validateJSONConfig(builder.jsonSchema, jsonDocument)
+		if err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				for i := range validationErr.Errors {
+					validationErr.Errors[i].Position, _ = lookupPosition(builder.positions, validationErr.Errors[i].Pointer)
+				}
+			}
+			return nil, nil, fmt.Errorf("configuration not valid: %w", err)
+		}
+	}
+	return k, builder.positions, nil
+}
+
+func (l *Loader) newDocumentBuilder() (*documentBuilder, error) {
+	jsonSchema := l.jsonSchema
+	if l.schemaFile != "" {
+		var err error
+		if jsonSchema, err = fs.ReadFile(l.fsys, l.schemaFile); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				err = markError(ErrConfigNotFound, err)
+			}
+			return nil, fmt.Errorf("error loading json schema: %w", err)
+		}
+	}
+
+	var schema map[string]interface{}
+	if jsonSchema != nil {
+		if err := json.Unmarshal(jsonSchema, &schema); err != nil {
+			return nil, markError(ErrInvalidSchema, fmt.Errorf("configuration not valid: error reading json schema: %w", err))
+		}
+	}
+	schemaStrategies, err := schemaMergeStrategies(schema)
+	if err != nil {
+		return nil, fmt.Errorf("configuration not valid: %w", err)
+	}
+
+	return &documentBuilder{
+		loader:     l,
+		jsonSchema: jsonSchema,
+		schema:     schema,
+		strategies: append(append(mergeStrategies{}, l.mergeStrategies...), schemaStrategies...),
+		document:   map[string]interface{}{},
+		positions:  map[string]Position{},
+	}, nil
+}
+
+// documentBuilder holds the configuration document while it is built from the loader sources.
+type documentBuilder struct {
+	loader     *Loader
+	jsonSchema []byte
+	schema     map[string]interface{}
+	strategies mergeStrategies
+	document   map[string]interface{}
+	// positions holds the position of the document values, indexed by their JSON Pointer.
+	positions map[string]Position
+}
+
+// merge merges a copy of document into the built one, using the loader merge strategies.
+// positions are the ones of the document values, and they can be nil if not known.
+func (b *documentBuilder) merge(document map[string]interface{}, positions map[string]Position) {
+	document = normalizeDocument(document)
+	b.mergePositions(b.document, document, positions, "", "", nil)
+	mergeDocument(b.document, document, b.strategies)
+}
+
+// normalizeDocument returns a copy of document where all the nested maps have string keys.
+func normalizeDocument(document map[string]interface{}) map[string]interface{} {
+	document = copyValue(document).(map[string]interface{})
+	maps.IntfaceKeysToStrings(document)
+	return document
+}
+
+func (l *Loader) decode(k *koanf.Koanf, positions map[string]Position, output interface{}) error {
+	result := output
+	switch value := reflect.ValueOf(output); {
+	case value.Kind() == reflect.Map && !value.IsNil():
+		// non nil maps are filled in place, as GetConfigFromFile always did
+		result = &output
+	case value.Kind() != reflect.Pointer || value.IsNil():
+		return markError(ErrDecode, fmt.Errorf("error unmarshalling file: output must be a non nil pointer or map, got %T", output))
+	}
+
+	if err := k.UnmarshalWithConf("", result, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			Metadata:         nil,
+			Result:           result,
+			WeaklyTypedInput: true,
+			ErrorUnused:      l.strict,
+		},
+	}); err != nil {
+		return markError(ErrDecode, fmt.Errorf("error unmarshalling file: %w", newDecodeErrors(err, positions, reflect.TypeOf(output))))
+	}
+	return nil
+}
+
+// mapProvider is a koanf provider for an already parsed document.
+type mapProvider map[string]interface{}
+
+func (m mapProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("mapProvider does not support ReadBytes")
+}
+
+func (m mapProvider) Read() (map[string]interface{}, error) {
+	return m, nil
+}
+
+// osFS is a fs.FS reading from the os file system, accepting both relative and absolute paths.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func fileExists(fsys fs.FS, filePath string) bool {
+	info, err := fs.Stat(fsys, filePath)
+	return err == nil && !info.IsDir()
+}
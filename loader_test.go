@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestLoader(t *testing.T) {
+	type Pool struct {
+		Size int `koanf:"size"`
+	}
+	type Database struct {
+		Host string `koanf:"host"`
+		Pool Pool   `koanf:"pool"`
+	}
+	type Configuration struct {
+		Name     string   `koanf:"name"`
+		Database Database `koanf:"db"`
+	}
+
+	fsys := fstest.MapFS{
+		"config/service.json": &fstest.MapFile{Data: []byte(`{
+			"name": "my-service",
+			"db": {"host": "localhost", "pool": {"size": 5}}
+		}`)},
+		"config/extra.yaml": &fstest.MapFile{Data: []byte("name: my-service\nunknown: true\n")},
+	}
+
+	t.Run("load config file from the given file system", func(t *testing.T) {
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("service", "config"))
+		err := loader.Load(context.Background(), &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{
+			Name:     "my-service",
+			Database: Database{Host: "localhost", Pool: Pool{Size: 5}},
+		})
+	})
+
+	t.Run("validate config file with json schema", func(t *testing.T) {
+		var config Configuration
+		loader := NewLoader(
+			WithFS(fsys),
+			WithFile("service", "config"),
+			WithSchema([]byte(`{"type": "object", "required": ["version"]}`)),
+		)
+		err := loader.Load(context.Background(), &config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), err.Error())
+	})
+
+	t.Run("throws on unknown keys in strict mode", func(t *testing.T) {
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("extra", "config"))
+		err := loader.Load(context.Background(), &config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "error unmarshalling file:"), err.Error())
+	})
+
+	t.Run("ignores unknown keys when strict mode is disabled", func(t *testing.T) {
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("extra", "config"), WithStrict(false))
+		err := loader.Load(context.Background(), &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Name, "my-service")
+	})
+
+	t.Run("override file values with env overlay", func(t *testing.T) {
+		t.Setenv("APP_DB__POOL__SIZE", "20")
+		t.Setenv("APP_NAME", "overridden")
+		t.Setenv("OTHER_NAME", "ignored")
+
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("service", "config"), WithEnvOverlay("APP"))
+		err := loader.Load(context.Background(), &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{
+			Name:     "overridden",
+			Database: Database{Host: "localhost", Pool: Pool{Size: 20}},
+		})
+	})
+
+	t.Run("throws if config file is not found in file system", func(t *testing.T) {
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("missing", "config"))
+		err := loader.Load(context.Background(), &config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "error loading config file:"), err.Error())
+	})
+
+	t.Run("throws if context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var config Configuration
+		loader := NewLoader(WithFS(fsys), WithFile("service", "config"))
+		err := loader.Load(ctx, &config)
+		assert.Assert(t, errors.Is(err, context.Canceled), "Error is not context canceled: %v", err)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	type Configuration struct {
+		Name string `koanf:"name"`
+		Port int    `koanf:"port"`
+	}
+
+	fsys := fstest.MapFS{
+		"service.yaml": &fstest.MapFile{Data: []byte("name: my-service\nport: 3000\n")},
+	}
+
+	t.Run("returns the typed configuration", func(t *testing.T) {
+		config, err := Load[Configuration](context.Background(), WithFS(fsys), WithFile("service", "."))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{Name: "my-service", Port: 3000})
+	})
+
+	t.Run("returns the configuration as map", func(t *testing.T) {
+		config, err := Load[map[string]interface{}](context.Background(), WithFS(fsys), WithFile("service", "."))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, map[string]interface{}{"name": "my-service", "port": 3000})
+	})
+
+	t.Run("returns zero value on error", func(t *testing.T) {
+		config, err := Load[Configuration](
+			context.Background(),
+			WithFS(fsys),
+			WithFile("service", "."),
+			WithSchema([]byte(`{"properties": {"port": {"maximum": 1024}}}`)),
+		)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.DeepEqual(t, config, Configuration{})
+	})
+
+	t.Run("throws if type is not a struct or a map", func(t *testing.T) {
+		_, err := Load[[]string](context.Background(), WithFS(fsys), WithFile("service", "."))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Equal(t, err.Error(), "unsupported config type []string: it must be a struct or a map")
+
+		_, err = Load[*Configuration](context.Background(), WithFS(fsys), WithFile("service", "."))
+		assert.Assert(t, err != nil, "Error is nil.")
+	})
+}
+
+func TestLoaderLoadOutput(t *testing.T) {
+	fsys := fstest.MapFS{
+		"service.json": &fstest.MapFile{Data: []byte(`{"name": "my-service"}`)},
+	}
+	loader := NewLoader(WithFS(fsys), WithFile("service", "."))
+
+	t.Run("throws if output is not a pointer", func(t *testing.T) {
+		var config map[string]interface{}
+		err := loader.Load(context.Background(), config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "output must be a non nil pointer"), err.Error())
+	})
+
+	t.Run("throws if output is a nil pointer", func(t *testing.T) {
+		var config *struct{}
+		err := loader.Load(context.Background(), config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "output must be a non nil pointer"), err.Error())
+	})
+}
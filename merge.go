@@ -0,0 +1,276 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type mergeKind int
+
+const (
+	mergeDefault mergeKind = iota
+	mergeReplace
+	mergeDeep
+	mergeAppend
+	mergeByKey
+)
+
+// MergeStrategy defines how a value set by a source is merged with the value set
+// by the sources before it. Without an explicit strategy maps are deep merged and arrays are replaced.
+type MergeStrategy struct {
+	kind mergeKind
+	key  string
+}
+
+var (
+	// MergeReplace replaces the previous map or array with the new one.
+	MergeReplace = MergeStrategy{kind: mergeReplace}
+	// MergeDeep merges maps key by key, recursively. It is the default strategy for maps.
+	MergeDeep = MergeStrategy{kind: mergeDeep}
+	// MergeAppend appends the items of the new array to the previous ones.
+	MergeAppend = MergeStrategy{kind: mergeAppend}
+)
+
+// MergeByKey merges arrays of objects matching their items by the value of the key field:
+// matching items are deep merged, while the other items of the new array are appended.
+func MergeByKey(key string) MergeStrategy {
+	return MergeStrategy{kind: mergeByKey, key: key}
+}
+
+func (s MergeStrategy) String() string {
+	switch s.kind {
+	case mergeReplace:
+		return "replace"
+	case mergeDeep:
+		return "deep"
+	case mergeAppend:
+		return "append"
+	case mergeByKey:
+		return fmt.Sprintf("merge by key %s", s.key)
+	default:
+		return "default"
+	}
+}
+
+// WithMergeStrategy sets the strategy used to merge the value at path when sources are layered.
+// The path is made of the object keys separated by dots, where a `*` matches any key; the items
+// of an array share the path of the array, so `servers.ports` is the path of the ports field of
+// the items of the servers array.
+//
+// Strategies can also be declared in the json schema with the `x-merge` annotation, whose value
+// is one of `replace`, `deep`, `append` or `merge-by-key`, the latter requiring the field name
+// in the `x-merge-key` annotation. Strategies set with WithMergeStrategy take precedence over the
+// schema annotations.
+func WithMergeStrategy(path string, strategy MergeStrategy) Option {
+	return func(l *Loader) {
+		l.mergeStrategies = append(l.mergeStrategies, pathMergeStrategy{
+			path:     splitMergePath(path),
+			strategy: strategy,
+		})
+	}
+}
+
+type pathMergeStrategy struct {
+	path     []string
+	strategy MergeStrategy
+}
+
+type mergeStrategies []pathMergeStrategy
+
+func splitMergePath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func (s mergeStrategies) lookup(path []string) MergeStrategy {
+	for _, candidate := range s {
+		if matchMergePath(candidate.path, path) {
+			return candidate.strategy
+		}
+	}
+	return MergeStrategy{}
+}
+
+func matchMergePath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaMergeStrategies collects the merge strategies declared in the json schema with
+// the x-merge annotation.
+func schemaMergeStrategies(schema map[string]interface{}) (mergeStrategies, error) {
+	var strategies mergeStrategies
+	if err := collectSchemaMergeStrategies(schema, nil, &strategies); err != nil {
+		return nil, err
+	}
+	return strategies, nil
+}
+
+func collectSchemaMergeStrategies(schema map[string]interface{}, path []string, strategies *mergeStrategies) error {
+	if annotation, ok := schema["x-merge"]; ok {
+		strategy, err := parseMergeAnnotation(annotation, schema["x-merge-key"])
+		if err != nil {
+			return markError(ErrInvalidSchema, fmt.Errorf("invalid x-merge annotation at %q: %w", strings.Join(path, "."), err))
+		}
+		*strategies = append(*strategies, pathMergeStrategy{
+			path:     append([]string{}, path...),
+			strategy: strategy,
+		})
+	}
+
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for key, property := range properties {
+			if propertySchema, ok := property.(map[string]interface{}); ok {
+				if err := collectSchemaMergeStrategies(propertySchema, append(path, key), strategies); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if additionalProperties, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		if err := collectSchemaMergeStrategies(additionalProperties, append(path, "*"), strategies); err != nil {
+			return err
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if err := collectSchemaMergeStrategies(items, path, strategies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseMergeAnnotation(annotation, key interface{}) (MergeStrategy, error) {
+	switch annotation {
+	case "replace":
+		return MergeReplace, nil
+	case "deep":
+		return MergeDeep, nil
+	case "append":
+		return MergeAppend, nil
+	case "merge-by-key":
+		keyName, ok := key.(string)
+		if !ok || keyName == "" {
+			return MergeStrategy{}, fmt.Errorf("merge-by-key requires the x-merge-key annotation")
+		}
+		return MergeByKey(keyName), nil
+	default:
+		return MergeStrategy{}, fmt.Errorf("unknown strategy %v", annotation)
+	}
+}
+
+// mergeDocument merges src into dst using the given strategies.
+// Values of src are moved into dst, so src must not be used after the merge.
+func mergeDocument(dst, src map[string]interface{}, strategies mergeStrategies) {
+	mergeMaps(dst, src, nil, strategies)
+}
+
+func mergeMaps(dst, src map[string]interface{}, path []string, strategies mergeStrategies) {
+	for key, srcValue := range src {
+		keyPath := append(path[:len(path):len(path)], key)
+		if dstValue, ok := dst[key]; ok {
+			dst[key] = mergeValues(dstValue, srcValue, keyPath, strategies)
+		} else {
+			dst[key] = srcValue
+		}
+	}
+}
+
+func mergeValues(dst, src interface{}, path []string, strategies mergeStrategies) interface{} {
+	strategy := strategies.lookup(path)
+
+	switch srcValue := src.(type) {
+	case map[string]interface{}:
+		dstValue, ok := dst.(map[string]interface{})
+		if !ok || strategy.kind == mergeReplace {
+			return srcValue
+		}
+		mergeMaps(dstValue, srcValue, path, strategies)
+		return dstValue
+	case []interface{}:
+		dstValue, ok := dst.([]interface{})
+		if !ok {
+			return srcValue
+		}
+		switch strategy.kind {
+		case mergeAppend:
+			return append(dstValue, srcValue...)
+		case mergeByKey:
+			return mergeArraysByKey(dstValue, srcValue, strategy.key, path, strategies)
+		default:
+			return srcValue
+		}
+	default:
+		return src
+	}
+}
+
+func mergeArraysByKey(dst, src []interface{}, key string, path []string, strategies mergeStrategies) []interface{} {
+	for _, srcItem := range src {
+		srcObject, ok := srcItem.(map[string]interface{})
+		keyValue, hasKey := srcObject[key]
+		if !ok || !hasKey {
+			dst = append(dst, srcItem)
+			continue
+		}
+
+		merged := false
+		for _, dstItem := range dst {
+			dstObject, ok := dstItem.(map[string]interface{})
+			if ok && reflect.DeepEqual(dstObject[key], keyValue) {
+				mergeMaps(dstObject, srcObject, path, strategies)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			dst = append(dst, srcItem)
+		}
+	}
+	return dst
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = copyValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return value
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestMergeStrategies(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.json": &fstest.MapFile{Data: []byte(`{
+			"tags": ["a"],
+			"labels": {"team": "core", "tier": "backend"},
+			"servers": [
+				{"name": "primary", "host": "localhost", "ports": [80]},
+				{"name": "secondary", "host": "localhost", "ports": [81]}
+			]
+		}`)},
+		"overlay.json": &fstest.MapFile{Data: []byte(`{
+			"tags": ["b"],
+			"labels": {"team": "platform"},
+			"servers": [
+				{"name": "primary", "host": "db.prod", "ports": [8080]},
+				{"name": "tertiary", "host": "db.backup", "ports": [82]}
+			]
+		}`)},
+	}
+	load := func(t *testing.T, opts ...Option) map[string]interface{} {
+		t.Helper()
+		opts = append([]Option{WithFS(fsys), WithFile("base", "."), WithFile("overlay", ".")}, opts...)
+		config, err := Load[map[string]interface{}](context.Background(), opts...)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		return config
+	}
+
+	t.Run("deep merge maps and replace arrays by default", func(t *testing.T) {
+		config := load(t)
+		assert.DeepEqual(t, config["tags"], []interface{}{"b"})
+		assert.DeepEqual(t, config["labels"], map[string]interface{}{"team": "platform", "tier": "backend"})
+		assert.Equal(t, len(config["servers"].([]interface{})), 2)
+	})
+
+	t.Run("apply strategies declared in code", func(t *testing.T) {
+		config := load(t,
+			WithMergeStrategy("tags", MergeAppend),
+			WithMergeStrategy("labels", MergeReplace),
+			WithMergeStrategy("servers", MergeByKey("name")),
+			WithMergeStrategy("servers.ports", MergeAppend),
+		)
+		assert.DeepEqual(t, config["tags"], []interface{}{"a", "b"})
+		assert.DeepEqual(t, config["labels"], map[string]interface{}{"team": "platform"})
+		assert.DeepEqual(t, config["servers"], []interface{}{
+			map[string]interface{}{"name": "primary", "host": "db.prod", "ports": []interface{}{float64(80), float64(8080)}},
+			map[string]interface{}{"name": "secondary", "host": "localhost", "ports": []interface{}{float64(81)}},
+			map[string]interface{}{"name": "tertiary", "host": "db.backup", "ports": []interface{}{float64(82)}},
+		})
+	})
+
+	t.Run("apply strategies declared in json schema", func(t *testing.T) {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"tags": {"type": "array", "x-merge": "append"},
+				"labels": {"type": "object", "x-merge": "replace"},
+				"servers": {
+					"type": "array",
+					"x-merge": "merge-by-key",
+					"x-merge-key": "name",
+					"items": {
+						"properties": {
+							"ports": {"x-merge": "append"}
+						}
+					}
+				}
+			}
+		}`)
+		config := load(t, WithSchema(jsonSchema))
+		assert.DeepEqual(t, config["tags"], []interface{}{"a", "b"})
+		assert.DeepEqual(t, config["labels"], map[string]interface{}{"team": "platform"})
+		assert.DeepEqual(t, config["servers"].([]interface{})[0], map[string]interface{}{
+			"name": "primary", "host": "db.prod", "ports": []interface{}{float64(80), float64(8080)},
+		})
+	})
+
+	t.Run("strategies declared in code take precedence over json schema", func(t *testing.T) {
+		jsonSchema := []byte(`{"properties": {"tags": {"x-merge": "append"}}}`)
+		config := load(t, WithSchema(jsonSchema), WithMergeStrategy("tags", MergeReplace))
+		assert.DeepEqual(t, config["tags"], []interface{}{"b"})
+	})
+
+	t.Run("match wildcard paths", func(t *testing.T) {
+		config := load(t, WithMergeStrategy("*", MergeReplace))
+		assert.DeepEqual(t, config["labels"], map[string]interface{}{"team": "platform"})
+	})
+
+	t.Run("throws if schema annotation is not valid", func(t *testing.T) {
+		jsonSchema := []byte(`{"properties": {"servers": {"x-merge": "merge-by-key"}}}`)
+		_, err := Load[map[string]interface{}](
+			context.Background(),
+			WithFS(fsys),
+			WithFile("base", "."),
+			WithSchema(jsonSchema),
+		)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), `invalid x-merge annotation at "servers"`), err.Error())
+	})
+}
+
+func TestMergeDocument(t *testing.T) {
+	t.Run("does not share values between merged documents", func(t *testing.T) {
+		source := map[string]interface{}{"list": []interface{}{"a"}, "object": map[string]interface{}{"key": "value"}}
+		document := map[string]interface{}{}
+		mergeDocument(document, copyValue(source).(map[string]interface{}), nil)
+		mergeDocument(document, map[string]interface{}{"object": map[string]interface{}{"other": "value"}}, nil)
+
+		assert.DeepEqual(t, source, map[string]interface{}{"list": []interface{}{"a"}, "object": map[string]interface{}{"key": "value"}})
+	})
+
+	t.Run("replace values of different types", func(t *testing.T) {
+		document := map[string]interface{}{"a": map[string]interface{}{"b": 1}, "c": []interface{}{1}}
+		mergeDocument(document, map[string]interface{}{"a": "scalar", "c": map[string]interface{}{"d": 1}}, mergeStrategies{
+			{path: []string{"c"}, strategy: MergeAppend},
+		})
+		assert.DeepEqual(t, document, map[string]interface{}{"a": "scalar", "c": map[string]interface{}{"d": 1}})
+	})
+}
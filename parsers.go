@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	kJson "github.com/knadh/koanf/parsers/json"
+	kYaml "github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+)
+
+var (
+	parsersMutex sync.RWMutex
+	parsers      = map[string]koanf.Parser{
+		"json":  jsonParser{kJson.Parser()},
+		"yaml":  yamlParser{kYaml.Parser()},
+		"yml":   yamlParser{kYaml.Parser()},
+		"toml":  TOMLParser{},
+		"jsonc": JSONCParser{},
+	}
+)
+
+// RegisterParser registers the parser used to read config files with the given extension.
+// The extension can be passed with or without the leading dot and it is case insensitive.
+// Registering an already registered extension replaces its parser.
+func RegisterParser(extension string, parser koanf.Parser) {
+	extension = normalizeExtension(extension)
+	if extension == "" || parser == nil {
+		panic("configlib: RegisterParser called with empty extension or nil parser")
+	}
+
+	parsersMutex.Lock()
+	defer parsersMutex.Unlock()
+	parsers[extension] = parser
+}
+
+// RegisteredExtensions returns the sorted list of extensions with a registered parser.
+func RegisteredExtensions() []string {
+	parsersMutex.RLock()
+	defer parsersMutex.RUnlock()
+
+	extensions := make([]string, 0, len(parsers))
+	for extension := range parsers {
+		extensions = append(extensions, extension)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+func getParser(extension string) (koanf.Parser, bool) {
+	parsersMutex.RLock()
+	defer parsersMutex.RUnlock()
+
+	parser, ok := parsers[normalizeExtension(extension)]
+	return parser, ok
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
+}
+
+// configFilePaths returns the paths where the config file configName is searched, one for each extension.
+func configFilePaths(configName, configPath string, extensions []string) []string {
+	filePaths := make([]string, 0, len(extensions))
+	for _, extension := range extensions {
+		filePaths = append(filePaths, path.Join(configPath, fmt.Sprintf("%s.%s", configName, extension)))
+	}
+	return filePaths
+}
+
+// findConfigFile searches configName in configPath with any registered extension and returns
+// the found file path together with the parser registered for its extension.
+// It fails if no file or more than one file is found.
+func findConfigFile(configName, configPath string, exists func(string) bool) (string, koanf.Parser, error) {
+	extensions := RegisteredExtensions()
+
+	var candidates []string
+	for _, filePath := range configFilePaths(configName, configPath, extensions) {
+		if exists(filePath) {
+			candidates = append(candidates, filePath)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", nil, &configFileNotFoundError{configName: configName, configPath: configPath, extensions: extensions}
+	case 1:
+		filePath := candidates[0]
+		parser, ok := getParser(filePath[strings.LastIndex(filePath, ".")+1:])
+		if !ok {
+			return "", nil, fmt.Errorf("no parser registered for config file %s", filePath)
+		}
+		return filePath, parser, nil
+	default:
+		return "", nil, fmt.Errorf("multiple config files found for %s in %s: %s", configName, configPath, strings.Join(candidates, ", "))
+	}
+}
+
+type configFileNotFoundError struct {
+	configName string
+	configPath string
+	extensions []string
+}
+
+// Is reports whether target is ErrConfigNotFound or fs.ErrNotExist.
+func (e *configFileNotFoundError) Is(target error) bool {
+	return target == ErrConfigNotFound || target == fs.ErrNotExist
+}
+
+func (e *configFileNotFoundError) Error() string {
+	return fmt.Sprintf("config file %s not found in %s with extensions %s", e.configName, e.configPath, strings.Join(e.extensions, ", "))
+}
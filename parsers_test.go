@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// keyValueParser parses files made of `key=value` lines.
+type keyValueParser struct{}
+
+func (keyValueParser) Unmarshal(b []byte) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		out[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+func (keyValueParser) Marshal(map[string]interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	assert.Equal(t, err, nil, "Error writing test file.")
+}
+
+func testFileExists(filePath string) bool {
+	return fileExists(osFS{}, filePath)
+}
+
+func unregisterTestParser(t *testing.T, extension string) {
+	t.Helper()
+	parsersMutex.Lock()
+	defer parsersMutex.Unlock()
+	delete(parsers, normalizeExtension(extension))
+}
+
+func TestRegisterParser(t *testing.T) {
+	t.Run("registered extensions contain the built-in formats", func(t *testing.T) {
+		extensions := RegisteredExtensions()
+		for _, extension := range []string{"json", "yaml", "yml", "toml"} {
+			_, ok := getParser(extension)
+			assert.Assert(t, ok, "Parser for %s not registered.", extension)
+		}
+		assert.Assert(t, len(extensions) >= 4, "Missing registered extensions.")
+	})
+
+	t.Run("load config file with a custom registered parser", func(t *testing.T) {
+		RegisterParser(".KV", keyValueParser{})
+		defer unregisterTestParser(t, "kv")
+
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.kv", "name=my-service\nport=3000\n")
+
+		type Configuration struct {
+			Name string `koanf:"name"`
+			Port int    `koanf:"port"`
+		}
+		var config Configuration
+		err := GetConfigFromFile("config", dir, nil, &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{Name: "my-service", Port: 3000})
+	})
+
+	t.Run("panics if extension is empty", func(t *testing.T) {
+		defer func() {
+			assert.Assert(t, recover() != nil, "RegisterParser does not panic.")
+		}()
+		RegisterParser(".", keyValueParser{})
+	})
+}
+
+func TestFindConfigFile(t *testing.T) {
+	t.Run("detects the config file extension", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.yml", "key: value\n")
+
+		filePath, parser, err := findConfigFile("config", dir, testFileExists)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, filePath, fmt.Sprintf("%s/config.yml", dir))
+		expectedParser, _ := getParser("yml")
+		assert.Equal(t, parser, expectedParser)
+	})
+
+	t.Run("throws if no config file is found", func(t *testing.T) {
+		_, _, err := findConfigFile("config", t.TempDir(), testFileExists)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "config file config not found in"), err.Error())
+	})
+
+	t.Run("throws if more than one config file is found", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", "{}")
+		writeTestFile(t, dir, "config.yaml", "{}")
+
+		_, _, err := findConfigFile("config", dir, testFileExists)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "multiple config files found for config"), err.Error())
+		assert.Assert(t, strings.Contains(err.Error(), "config.json"), err.Error())
+		assert.Assert(t, strings.Contains(err.Error(), "config.yaml"), err.Error())
+	})
+
+	t.Run("ignores directories named as config files", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.Mkdir(filepath.Join(dir, "config.json"), 0700)
+		assert.Equal(t, err, nil, "Error creating directory.")
+		writeTestFile(t, dir, "config.yaml", "{}")
+
+		filePath, _, err := findConfigFile("config", dir, testFileExists)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, filePath, fmt.Sprintf("%s/config.yaml", dir))
+	})
+}
@@ -0,0 +1,369 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// patchSource is implemented by the sources that transform the document built by the sources
+// before them, instead of being merged into it.
+type patchSource interface {
+	patch(ctx context.Context, b *documentBuilder) error
+}
+
+type mergePatchSource struct {
+	file fileSource
+}
+
+// MergePatchSource is a config file holding a JSON Merge Patch (RFC 7396) applied to the document
+// built by the sources before it: objects are merged recursively, null values remove the
+// corresponding keys and any other value replaces the previous one.
+// The file is searched and parsed like a FileSource, so the patch can be written in any supported format.
+func MergePatchSource(configName, configPath string) Source {
+	return mergePatchSource{file: fileSource{configName: configName, configPath: configPath}}
+}
+
+func (s mergePatchSource) String() string {
+	return fmt.Sprintf("merge patch %s in %s", s.file.configName, s.file.configPath)
+}
+
+func (s mergePatchSource) load(ctx context.Context, l *Loader) (map[string]interface{}, map[string]Position, error) {
+	return s.file.load(ctx, l)
+}
+
+func (s mergePatchSource) patch(ctx context.Context, b *documentBuilder) error {
+	mergePatch, positions, err := s.load(ctx, b.loader)
+	if err != nil {
+		return err
+	}
+	mergePatch = normalizeDocument(mergePatch)
+	b.mergePatchPositions(mergePatch, positions, "")
+	b.document = applyMergePatch(b.document, mergePatch)
+	return nil
+}
+
+func (s mergePatchSource) watchPaths() []string {
+	return s.file.watchPaths()
+}
+
+func applyMergePatch(target, mergePatch map[string]interface{}) map[string]interface{} {
+	for key, value := range mergePatch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		patchObject, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+		targetObject, ok := target[key].(map[string]interface{})
+		if !ok {
+			targetObject = map[string]interface{}{}
+		}
+		target[key] = applyMergePatch(targetObject, patchObject)
+	}
+	return target
+}
+
+type jsonPatchSource struct {
+	configName string
+	configPath string
+}
+
+// JSONPatchSource is a json file holding a JSON Patch (RFC 6902) applied to the document built by
+// the sources before it. The file is searched in configPath as configName with the json extension.
+// All the operations of the standard are supported: add, remove, replace, move, copy and test.
+func JSONPatchSource(configName, configPath string) Source {
+	return jsonPatchSource{configName: configName, configPath: configPath}
+}
+
+func (s jsonPatchSource) String() string {
+	return fmt.Sprintf("json patch %s in %s", s.configName, s.configPath)
+}
+
+func (s jsonPatchSource) filePath() string {
+	return path.Join(s.configPath, fmt.Sprintf("%s.json", s.configName))
+}
+
+func (s jsonPatchSource) watchPaths() []string {
+	return []string{s.filePath()}
+}
+
+func (s jsonPatchSource) load(context.Context, *Loader) (map[string]interface{}, map[string]Position, error) {
+	return nil, nil, errors.New("json patch can not be merged")
+}
+
+func (s jsonPatchSource) patch(_ context.Context, b *documentBuilder) error {
+	filePath := s.filePath()
+	content, err := fs.ReadFile(b.loader.fsys, filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return markError(ErrConfigNotFound, fmt.Errorf("error loading json patch: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("error loading json patch: %w", err)
+	}
+
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(content, &operations); err != nil {
+		return markError(ErrDecode, fmt.Errorf("error loading json patch: %s: %w", filePath, err))
+	}
+
+	var patched interface{} = b.document
+	for index, operation := range operations {
+		b.jsonPatchPositions(patched, operation, filePath)
+		if patched, err = operation.apply(patched); err != nil {
+			return fmt.Errorf("error applying json patch %s: operation %d (%s %s): %w", filePath, index, operation.Op, operation.Path, err)
+		}
+	}
+
+	patchedDocument, ok := patched.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("error applying json patch %s: patched document is not an object", filePath)
+	}
+	b.document = patchedDocument
+	return nil
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (o jsonPatchOperation) apply(document interface{}) (interface{}, error) {
+	tokens, err := parseJSONPointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		if o.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		var value interface{}
+		if err := json.Unmarshal(o.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+		switch o.Op {
+		case "add":
+			return pointerAdd(document, tokens, value)
+		case "replace":
+			if _, err := pointerGet(document, tokens); err != nil {
+				return nil, err
+			}
+			if len(tokens) == 0 {
+				return value, nil
+			}
+			if document, _, err = pointerRemove(document, tokens); err != nil {
+				return nil, err
+			}
+			return pointerAdd(document, tokens, value)
+		default:
+			current, err := pointerGet(document, tokens)
+			if err != nil {
+				return nil, err
+			}
+			if !jsonEqual(current, value) {
+				return nil, errors.New("test failed: value is different")
+			}
+			return document, nil
+		}
+	case "remove":
+		document, _, err = pointerRemove(document, tokens)
+		return document, err
+	case "move", "copy":
+		fromTokens, err := parseJSONPointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if o.Op == "move" {
+			if strings.HasPrefix(o.Path, o.From+"/") {
+				return nil, fmt.Errorf("can not move %s into one of its children", o.From)
+			}
+			if document, value, err = pointerRemove(document, fromTokens); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = pointerGet(document, fromTokens); err != nil {
+				return nil, err
+			}
+			value = copyValue(value)
+		}
+		return pointerAdd(document, tokens, value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", o.Op)
+	}
+}
+
+// parseJSONPointer splits a JSON Pointer (RFC 6901) in its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func parseArrayIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+func pointerGet(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", token)
+			}
+			node = value
+		case []interface{}:
+			index, err := parseArrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("can not resolve %q in a scalar value", token)
+		}
+	}
+	return node, nil
+}
+
+func pointerAdd(node interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token := tokens[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(tokens) == 1 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found", token)
+		}
+		updated, err := pointerAdd(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []interface{}:
+		if len(tokens) == 1 {
+			if token == "-" {
+				return append(n, value), nil
+			}
+			index, err := parseArrayIndex(token, len(n)+1)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+		index, err := parseArrayIndex(token, len(n))
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerAdd(n[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("can not resolve %q in a scalar value", token)
+	}
+}
+
+func pointerRemove(node interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("can not remove the document root")
+	}
+
+	token := tokens[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("key %q not found", token)
+		}
+		if len(tokens) == 1 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := pointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = updated
+		return n, removed, nil
+	case []interface{}:
+		index, err := parseArrayIndex(token, len(n))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tokens) == 1 {
+			removed := n[index]
+			return append(n[:index:index], n[index+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(n[index], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[index] = updated
+		return n, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("can not resolve %q in a scalar value", token)
+	}
+}
+
+// jsonEqual compares two values by their json representation, so that numbers parsed
+// with different types are considered equal.
+func jsonEqual(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
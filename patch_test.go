@@ -0,0 +1,159 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestMergePatchSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.json": &fstest.MapFile{Data: []byte(`{
+			"name": "my-service",
+			"debug": true,
+			"db": {"host": "localhost", "pool": {"size": 5}},
+			"tags": ["a", "b"]
+		}`)},
+		"config.production.yaml": &fstest.MapFile{Data: []byte("debug: null\ndb:\n  host: db.prod\n  pool: null\ntags: [c]\n")},
+	}
+
+	t.Run("apply merge patch removing null keys", func(t *testing.T) {
+		config, err := Load[map[string]interface{}](context.Background(), WithFS(fsys), WithSources(
+			FileSource("config", "."),
+			MergePatchSource("config.production", "."),
+		))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, map[string]interface{}{
+			"name": "my-service",
+			"db":   map[string]interface{}{"host": "db.prod"},
+			"tags": []interface{}{"c"},
+		})
+	})
+
+	t.Run("throws if merge patch file is not found", func(t *testing.T) {
+		_, err := Load[map[string]interface{}](context.Background(), WithFS(fsys), WithSources(
+			FileSource("config", "."),
+			MergePatchSource("config.staging", "."),
+		))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "config file config.staging not found"), err.Error())
+	})
+}
+
+func TestJSONPatchSource(t *testing.T) {
+	base := []byte(`{
+		"name": "my-service",
+		"debug": true,
+		"db": {"host": "localhost", "port": 5432},
+		"tags": ["a", "b"],
+		"a/b": {"c~d": 1}
+	}`)
+	load := func(t *testing.T, patch string) (map[string]interface{}, error) {
+		t.Helper()
+		fsys := fstest.MapFS{
+			"config.json":       &fstest.MapFile{Data: base},
+			"config.patch.json": &fstest.MapFile{Data: []byte(patch)},
+		}
+		return Load[map[string]interface{}](context.Background(), WithFS(fsys), WithSources(
+			FileSource("config", "."),
+			JSONPatchSource("config.patch", "."),
+		))
+	}
+
+	t.Run("apply all the operations", func(t *testing.T) {
+		config, err := load(t, `[
+			{"op": "test", "path": "/db/port", "value": 5432},
+			{"op": "replace", "path": "/db/host", "value": "db.prod"},
+			{"op": "remove", "path": "/debug"},
+			{"op": "add", "path": "/tags/1", "value": "inserted"},
+			{"op": "add", "path": "/tags/-", "value": "last"},
+			{"op": "copy", "from": "/db", "path": "/replica"},
+			{"op": "move", "from": "/a~1b/c~0d", "path": "/moved"},
+			{"op": "add", "path": "/replica/host", "value": "db.replica"}
+		]`)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, map[string]interface{}{
+			"name":    "my-service",
+			"db":      map[string]interface{}{"host": "db.prod", "port": float64(5432)},
+			"replica": map[string]interface{}{"host": "db.replica", "port": float64(5432)},
+			"tags":    []interface{}{"a", "inserted", "b", "last"},
+			"a/b":     map[string]interface{}{},
+			"moved":   float64(1),
+		})
+	})
+
+	testCases := []struct {
+		name    string
+		patch   string
+		message string
+	}{
+		{
+			name:    "removed path does not exist",
+			patch:   `[{"op": "add", "path": "/x", "value": 1}, {"op": "remove", "path": "/db/user"}]`,
+			message: `error applying json patch config.patch.json: operation 1 (remove /db/user): key "user" not found`,
+		},
+		{
+			name:    "test operation fails",
+			patch:   `[{"op": "test", "path": "/name", "value": "other"}]`,
+			message: "error applying json patch config.patch.json: operation 0 (test /name): test failed: value is different",
+		},
+		{
+			name:    "array index is out of range",
+			patch:   `[{"op": "replace", "path": "/tags/5", "value": "x"}]`,
+			message: `error applying json patch config.patch.json: operation 0 (replace /tags/5): invalid array index "5"`,
+		},
+		{
+			name:    "value is missing",
+			patch:   `[{"op": "add", "path": "/x"}]`,
+			message: "error applying json patch config.patch.json: operation 0 (add /x): missing value",
+		},
+		{
+			name:    "operation is unknown",
+			patch:   `[{"op": "merge", "path": "/x"}]`,
+			message: `error applying json patch config.patch.json: operation 0 (merge /x): unknown operation "merge"`,
+		},
+		{
+			name:    "moving a value into its children",
+			patch:   `[{"op": "move", "from": "/db", "path": "/db/nested"}]`,
+			message: "error applying json patch config.patch.json: operation 0 (move /db/nested): can not move /db into one of its children",
+		},
+		{
+			name:    "document root is replaced with a scalar",
+			patch:   `[{"op": "replace", "path": "", "value": 1}]`,
+			message: "error applying json patch config.patch.json: patched document is not an object",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run("throws if "+testCase.name, func(t *testing.T) {
+			_, err := load(t, testCase.patch)
+			assert.Assert(t, err != nil, "Error is nil.")
+			assert.Equal(t, err.Error(), testCase.message)
+		})
+	}
+
+	t.Run("throws if patch is not a json array", func(t *testing.T) {
+		_, err := load(t, `{"op": "remove"}`)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "error loading json patch: config.patch.json:"), err.Error())
+	})
+}
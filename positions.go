@@ -0,0 +1,417 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	kJson "github.com/knadh/koanf/parsers/json"
+	kYaml "github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/v2"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Position is the location of a configuration value. File is the config file, or the
+// env variable, the value comes from; Line and Column are zero when not known.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	var position string
+	switch {
+	case p.Line == 0:
+		return p.File
+	case p.Column == 0:
+		position = strconv.Itoa(p.Line)
+	default:
+		position = fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if p.File == "" {
+		return position
+	}
+	return p.File + ":" + position
+}
+
+// IsValid reports whether the position is known.
+func (p Position) IsValid() bool {
+	return p.File != "" || p.Line > 0
+}
+
+// PositionParser is a parser able to report where the values of a document are defined.
+// Config files read with a PositionParser report line and column in the errors about their values,
+// otherwise only the file name is reported.
+type PositionParser interface {
+	koanf.Parser
+	// Positions returns the position of the values of the document, indexed by their JSON Pointer.
+	Positions(b []byte) (map[string]Position, error)
+}
+
+// jsonParser is the koanf json parser, able to report positions and reporting
+// line and column of its syntax errors.
+type jsonParser struct {
+	*kJson.JSON
+}
+
+func (p jsonParser) Unmarshal(b []byte) (map[string]interface{}, error) {
+	out, err := p.JSON.Unmarshal(b)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, newOffsetSyntaxError(b, syntaxErr.Offset, err)
+		case errors.As(err, &typeErr):
+			return nil, newOffsetSyntaxError(b, typeErr.Offset, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (jsonParser) Positions(b []byte) (map[string]Position, error) {
+	return JSONCParser{}.Positions(b)
+}
+
+// newOffsetSyntaxError returns a SyntaxError for the error occurred reading the byte before offset.
+func newOffsetSyntaxError(b []byte, offset int64, err error) *SyntaxError {
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line := 1 + strings.Count(string(before), "\n")
+	column := 1 + utf8.RuneCount(before[strings.LastIndex(string(before), "\n")+1:])
+	return &SyntaxError{Position: Position{Line: line, Column: column}, Msg: err.Error(), Err: err}
+}
+
+// yamlParser is the koanf yaml parser, able to report positions and reporting
+// the line of its syntax errors.
+type yamlParser struct {
+	*kYaml.YAML
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func (p yamlParser) Unmarshal(b []byte) (map[string]interface{}, error) {
+	out, err := p.YAML.Unmarshal(b)
+	if err != nil {
+		if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return nil, &SyntaxError{Position: Position{Line: line}, Msg: match[2], Err: err}
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (yamlParser) Positions(b []byte) (map[string]Position, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, err
+	}
+	positions := map[string]Position{}
+	collectYAMLPositions(&node, "", positions, 0)
+	return positions, nil
+}
+
+// maxYAMLAliasDepth bounds the aliases followed while collecting positions.
+const maxYAMLAliasDepth = 32
+
+func collectYAMLPositions(node *yaml.Node, pointer string, positions map[string]Position, aliasDepth int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			positions[pointer] = Position{Line: child.Line, Column: child.Column}
+			collectYAMLPositions(child, pointer, positions, aliasDepth)
+		}
+	case yaml.AliasNode:
+		if aliasDepth < maxYAMLAliasDepth {
+			collectYAMLPositions(node.Alias, pointer, positions, aliasDepth+1)
+		}
+	case yaml.MappingNode:
+		// merged keys are collected first, so that the keys set explicitly override them
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if key := node.Content[i]; key.Tag == "!!merge" {
+				collectYAMLMergePositions(node.Content[i+1], pointer, positions, aliasDepth)
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				continue
+			}
+			keyPointer := pointer + "/" + escapeJSONPointerToken(key.Value)
+			positions[keyPointer] = Position{Line: key.Line, Column: key.Column}
+			collectYAMLPositions(value, keyPointer, positions, aliasDepth)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPointer := fmt.Sprintf("%s/%d", pointer, i)
+			positions[itemPointer] = Position{Line: item.Line, Column: item.Column}
+			collectYAMLPositions(item, itemPointer, positions, aliasDepth)
+		}
+	}
+}
+
+func collectYAMLMergePositions(node *yaml.Node, pointer string, positions map[string]Position, aliasDepth int) {
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			collectYAMLPositions(item, pointer, positions, aliasDepth)
+		}
+		return
+	}
+	collectYAMLPositions(node, pointer, positions, aliasDepth)
+}
+
+// Positions returns the position of the keys of the given TOML bytes.
+func (TOMLParser) Positions(b []byte) (map[string]Position, error) {
+	positions := map[string]Position{"": {Line: 1, Column: 1}}
+	arrayTables := map[string]int{}
+
+	p := unstable.Parser{}
+	p.Reset(b)
+	var table string
+	for p.NextExpression() {
+		expression := p.Expression()
+		switch expression.Kind {
+		case unstable.Table:
+			table = collectTOMLKeyPositions(&p, expression.Key(), "", positions)
+		case unstable.ArrayTable:
+			arrayTable := collectTOMLKeyPositions(&p, expression.Key(), "", positions)
+			table = fmt.Sprintf("%s/%d", arrayTable, arrayTables[arrayTable])
+			arrayTables[arrayTable]++
+			positions[table] = positions[arrayTable]
+		case unstable.KeyValue:
+			collectTOMLKeyValuePositions(&p, expression, table, positions)
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+func collectTOMLKeyValuePositions(p *unstable.Parser, keyValue *unstable.Node, table string, positions map[string]Position) {
+	pointer := collectTOMLKeyPositions(p, keyValue.Key(), table, positions)
+	if value := keyValue.Value(); value.Kind == unstable.InlineTable {
+		children := value.Children()
+		for children.Next() {
+			collectTOMLKeyValuePositions(p, children.Node(), pointer, positions)
+		}
+	}
+}
+
+func collectTOMLKeyPositions(p *unstable.Parser, key unstable.Iterator, pointer string, positions map[string]Position) string {
+	for key.Next() {
+		node := key.Node()
+		pointer += "/" + escapeJSONPointerToken(string(node.Data))
+		if _, ok := positions[pointer]; !ok {
+			shape := p.Shape(node.Raw)
+			positions[pointer] = Position{Line: shape.Start.Line, Column: shape.Start.Column}
+		}
+	}
+	return pointer
+}
+
+func newTOMLSyntaxError(err error) error {
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, column := decodeErr.Position()
+		return &SyntaxError{Position: Position{Line: line, Column: column}, Msg: err.Error(), Err: err}
+	}
+	return err
+}
+
+// documentPositions returns the position of all the values of document, read from the given
+// file content with parser. Positions are limited to the file name if parser is not a PositionParser.
+func documentPositions(file string, content []byte, parser koanf.Parser, document map[string]interface{}) map[string]Position {
+	positions := map[string]Position{}
+	if positionParser, ok := parser.(PositionParser); ok {
+		if parsed, err := positionParser.Positions(content); err == nil {
+			for pointer, position := range parsed {
+				position.File = file
+				positions[pointer] = position
+			}
+			return positions
+		}
+	}
+	walkDocument(document, "", func(pointer string) {
+		positions[pointer] = Position{File: file}
+	})
+	return positions
+}
+
+// walkDocument calls fn with the JSON Pointer of value and of all its nested values.
+func walkDocument(value interface{}, pointer string, fn func(pointer string)) {
+	fn(pointer)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			walkDocument(item, pointer+"/"+escapeJSONPointerToken(key), fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			walkDocument(item, fmt.Sprintf("%s/%d", pointer, i), fn)
+		}
+	}
+}
+
+// lookupPosition returns the position of the value at pointer, falling back to the position of
+// its closest parent.
+func lookupPosition(positions map[string]Position, pointer string) (Position, bool) {
+	for {
+		if position, ok := positions[pointer]; ok {
+			return position, true
+		}
+		if pointer == "" {
+			return Position{}, false
+		}
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// mergePositions updates the positions of the built document before src is merged into dst,
+// mirroring the merge strategies. srcPointer is the pointer of src in its own document, while
+// dstPointer and path are the ones of dst in the built document.
+func (b *documentBuilder) mergePositions(dst, src interface{}, srcPositions map[string]Position, srcPointer, dstPointer string, path []string) {
+	strategy := b.strategies.lookup(path)
+	switch srcValue := src.(type) {
+	case map[string]interface{}:
+		dstValue, ok := dst.(map[string]interface{})
+		if !ok || strategy.kind == mergeReplace {
+			b.copyPositions(src, srcPositions, srcPointer, dstPointer)
+			return
+		}
+		b.setPosition(dstPointer, srcPositions, srcPointer)
+		for key, item := range srcValue {
+			token := "/" + escapeJSONPointerToken(key)
+			b.mergePositions(dstValue[key], item, srcPositions, srcPointer+token, dstPointer+token, append(path, key))
+		}
+	case []interface{}:
+		dstValue, ok := dst.([]interface{})
+		switch {
+		case ok && strategy.kind == mergeAppend:
+			b.setPosition(dstPointer, srcPositions, srcPointer)
+			for i, item := range srcValue {
+				b.copyPositions(item, srcPositions, fmt.Sprintf("%s/%d", srcPointer, i), fmt.Sprintf("%s/%d", dstPointer, len(dstValue)+i))
+			}
+		case ok && strategy.kind == mergeByKey:
+			// items merged by key keep their positions, while the appended ones fall back to the array one
+			b.setPosition(dstPointer, srcPositions, srcPointer)
+		default:
+			b.copyPositions(src, srcPositions, srcPointer, dstPointer)
+		}
+	default:
+		b.copyPositions(src, srcPositions, srcPointer, dstPointer)
+	}
+}
+
+// mergePatchPositions updates the positions of the built document before mergePatch is applied to it.
+func (b *documentBuilder) mergePatchPositions(mergePatch map[string]interface{}, patchPositions map[string]Position, pointer string) {
+	for key, value := range mergePatch {
+		keyPointer := pointer + "/" + escapeJSONPointerToken(key)
+		switch value := value.(type) {
+		case nil:
+			b.clearPositions(keyPointer)
+		case map[string]interface{}:
+			b.setPosition(keyPointer, patchPositions, keyPointer)
+			b.mergePatchPositions(value, patchPositions, keyPointer)
+		default:
+			b.copyPositions(value, patchPositions, keyPointer, keyPointer)
+		}
+	}
+}
+
+// jsonPatchPositions updates the positions of document before operation is applied to it.
+// Values set by the operation get the position of the patch file.
+func (b *documentBuilder) jsonPatchPositions(document interface{}, operation jsonPatchOperation, file string) {
+	clearPointer := func(pointer string) {
+		tokens, err := parseJSONPointer(pointer)
+		if err != nil || len(tokens) == 0 {
+			b.clearPositions(pointer)
+			return
+		}
+		// adding or removing an array item shifts the following ones
+		if parent, err := pointerGet(document, tokens[:len(tokens)-1]); err == nil && isArray(parent) {
+			b.clearChildPositions(toJSONPointer(tokens[:len(tokens)-1]))
+			return
+		}
+		b.clearPositions(pointer)
+	}
+
+	switch operation.Op {
+	case "test":
+		return
+	case "move":
+		clearPointer(operation.From)
+	}
+	clearPointer(operation.Path)
+	if operation.Op != "remove" {
+		b.positions[operation.Path] = Position{File: file}
+	}
+}
+
+func isArray(value interface{}) bool {
+	_, ok := value.([]interface{})
+	return ok
+}
+
+// setPosition sets the position of dstPointer to the one of srcPointer in srcPositions.
+func (b *documentBuilder) setPosition(dstPointer string, srcPositions map[string]Position, srcPointer string) {
+	if position, ok := srcPositions[srcPointer]; ok {
+		b.positions[dstPointer] = position
+	} else {
+		delete(b.positions, dstPointer)
+	}
+}
+
+// copyPositions replaces the positions of dstPointer and its children with the ones
+// of value, that is at srcPointer in srcPositions.
+func (b *documentBuilder) copyPositions(value interface{}, srcPositions map[string]Position, srcPointer, dstPointer string) {
+	b.clearPositions(dstPointer)
+	walkDocument(value, "", func(pointer string) {
+		b.setPosition(dstPointer+pointer, srcPositions, srcPointer+pointer)
+	})
+}
+
+// clearPositions removes the positions of pointer and its children.
+func (b *documentBuilder) clearPositions(pointer string) {
+	delete(b.positions, pointer)
+	b.clearChildPositions(pointer)
+}
+
+// clearChildPositions removes the positions of the children of pointer.
+func (b *documentBuilder) clearChildPositions(pointer string) {
+	for key := range b.positions {
+		if strings.HasPrefix(key, pointer+"/") {
+			delete(b.positions, key)
+		}
+	}
+}
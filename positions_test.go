@@ -0,0 +1,180 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestParserPositions(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		positions, err := jsonParser{}.Positions([]byte("{\n  \"db\": {\n    \"hosts\": [\"a\", \"b\"]\n  }\n}\n"))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, positions["/db"], Position{Line: 2, Column: 3})
+		assert.Equal(t, positions["/db/hosts"], Position{Line: 3, Column: 5})
+		assert.Equal(t, positions["/db/hosts/1"], Position{Line: 3, Column: 20})
+	})
+
+	t.Run("yaml with anchors and merge keys", func(t *testing.T) {
+		positions, err := yamlParser{}.Positions([]byte("base: &base\n  host: localhost\ndb:\n  <<: *base\n  port: 5432\n"))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, positions["/db"], Position{Line: 3, Column: 1})
+		assert.Equal(t, positions["/db/host"], Position{Line: 2, Column: 3})
+		assert.Equal(t, positions["/db/port"], Position{Line: 5, Column: 3})
+	})
+
+	t.Run("toml with tables and array tables", func(t *testing.T) {
+		positions, err := TOMLParser{}.Positions([]byte("name = 'a'\n[db]\nhost = 'b'\n[[db.replicas]]\nhost = 'c'\n[[db.replicas]]\nhost = 'd'\n"))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, positions["/name"], Position{Line: 1, Column: 1})
+		assert.Equal(t, positions["/db/host"], Position{Line: 3, Column: 1})
+		assert.Equal(t, positions["/db/replicas/1/host"], Position{Line: 7, Column: 1})
+	})
+}
+
+func TestSyntaxErrorPositions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.json": &fstest.MapFile{Data: []byte("{\n  \"name\": \"a\",\n}\n")},
+		"config.yaml": &fstest.MapFile{Data: []byte("name: a\n  port: 3000\n")},
+		"config.toml": &fstest.MapFile{Data: []byte("name = 'a'\nport = \n")},
+	}
+
+	for name, expected := range map[string]Position{
+		"config.json": {File: "config.json", Line: 3, Column: 1},
+		"config.yaml": {File: "config.yaml", Line: 2},
+		"config.toml": {File: "config.toml", Line: 2, Column: 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := fstest.MapFS{name: fsys[name]}
+			_, err := Load[map[string]interface{}](context.Background(), WithFS(fsys), WithFile("config", "."))
+			var syntaxErr *SyntaxError
+			assert.Assert(t, errors.As(err, &syntaxErr), "Error is not a SyntaxError: %v", err)
+			assert.Equal(t, syntaxErr.Position, expected)
+			assert.Assert(t, errors.Is(err, ErrDecode))
+		})
+	}
+
+	t.Run("json syntax errors keep the json error", func(t *testing.T) {
+		fsys := fstest.MapFS{"config.json": fsys["config.json"]}
+		_, err := Load[map[string]interface{}](context.Background(), WithFS(fsys), WithFile("config", "."))
+		var jsonErr *json.SyntaxError
+		assert.Assert(t, errors.As(err, &jsonErr), "Error is not a json.SyntaxError: %v", err)
+	})
+}
+
+func TestLoaderErrorPositions(t *testing.T) {
+	type Configuration struct {
+		Name string `koanf:"name"`
+		Port int    `koanf:"port"`
+	}
+	fsys := fstest.MapFS{
+		"config.yaml":            &fstest.MapFile{Data: []byte("name: my-service\nport: 3000\n")},
+		"config.production.json": &fstest.MapFile{Data: []byte("{\n  \"port\": \"not a port\"\n}\n")},
+		"config.local.toml":      &fstest.MapFile{Data: []byte("name = 'local'\nunknown = true\n")},
+	}
+	schema := []byte(`{"properties": {"port": {"type": "integer", "maximum": 8080}}}`)
+
+	t.Run("validation errors report the overlay file setting the value", func(t *testing.T) {
+		_, err := Load[Configuration](context.Background(),
+			WithFS(fsys),
+			WithSchema(schema),
+			WithFile("config", "."),
+			WithFile("config.production", "."),
+		)
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Equal(t, validationErr.Errors[0].Position, Position{File: "config.production.json", Line: 2, Column: 3})
+	})
+
+	t.Run("validation errors report the env variable setting the value", func(t *testing.T) {
+		_, err := Load[Configuration](context.Background(),
+			WithFS(fsys),
+			WithSchema(schema),
+			WithFile("config", "."),
+			WithEnvOverlay("APP"),
+			WithEnvMap(map[string]string{"APP_PORT": "9000"}),
+		)
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Equal(t, validationErr.Errors[0].Position, Position{File: "env APP_PORT"})
+		assert.Equal(t, validationErr.Errors[0].Error(), "env APP_PORT: /port: Must be less than or equal to 8080")
+	})
+
+	t.Run("decode errors report the position of each field", func(t *testing.T) {
+		_, err := Load[Configuration](context.Background(),
+			WithFS(fsys),
+			WithFile("config", "."),
+			WithFile("config.production", "."),
+			WithFile("config.local", "."),
+		)
+		assert.Assert(t, errors.Is(err, ErrDecode))
+
+		var decodeErr *DecodeError
+		assert.Assert(t, errors.As(err, &decodeErr), "Error is not a DecodeError: %v", err)
+		assert.ErrorContains(t, err, "config.production.json:2:3: /port: ")
+		assert.ErrorContains(t, err, "config.local.toml:2:1: /unknown: unknown key")
+	})
+
+	t.Run("merge patches and json patches update positions", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"config.yaml":   &fstest.MapFile{Data: []byte("name: my-service\nports: [1, 2]\n")},
+			"patch.yaml":    &fstest.MapFile{Data: []byte("name: null\nport: 9000\n")},
+			"replicas.json": &fstest.MapFile{Data: []byte(`[{"op": "add", "path": "/ports/0", "value": 9000}]`)},
+		}
+		schema := []byte(`{"properties": {
+			"port": {"maximum": 8080},
+			"ports": {"items": {"maximum": 8080}}
+		}}`)
+		_, err := Load[map[string]interface{}](context.Background(),
+			WithFS(fsys),
+			WithSchema(schema),
+			WithFile("config", "."),
+			WithSources(MergePatchSource("patch", "."), JSONPatchSource("replicas", ".")),
+		)
+		var validationErr *ValidationError
+		assert.Assert(t, errors.As(err, &validationErr), "Error is not a ValidationError: %v", err)
+		assert.Equal(t, len(validationErr.Errors), 2)
+		positions := map[string]Position{}
+		for _, fieldError := range validationErr.Errors {
+			positions[fieldError.Pointer] = fieldError.Position
+		}
+		assert.DeepEqual(t, positions, map[string]Position{
+			"/port":    {File: "patch.yaml", Line: 2, Column: 1},
+			"/ports/0": {File: "replicas.json"},
+		})
+	})
+}
+
+func TestPositionString(t *testing.T) {
+	assert.Equal(t, Position{File: "config.json", Line: 3, Column: 5}.String(), "config.json:3:5")
+	assert.Equal(t, Position{File: "config.yaml", Line: 3}.String(), "config.yaml:3")
+	assert.Equal(t, Position{File: "env APP_PORT"}.String(), "env APP_PORT")
+	assert.Equal(t, Position{Line: 3, Column: 5}.String(), "3:5")
+}
+
+func TestDecodeNameToPointer(t *testing.T) {
+	assert.Equal(t, decodeNameToPointer(""), "")
+	assert.Equal(t, decodeNameToPointer("db.hosts[0].name"), "/db/hosts/0/name")
+	assert.Equal(t, decodeNameToPointer("labels[app/name]"), "/labels/app~1name")
+	assert.Equal(t, decodeNameToPointer("matrix[1][2]"), "/matrix/1/2")
+}
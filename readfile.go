@@ -26,17 +26,17 @@ import (
 func ReadFile(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("open file error: %s", err.Error())
+		return nil, fmt.Errorf("open file error: %w", err)
 	}
 	defer func(fileToClose *os.File) {
 		err := fileToClose.Close()
 		if err != nil {
-			panic(fmt.Errorf("error closing file %s: %s", filePath, err.Error()))
+			panic(fmt.Errorf("error closing file %s: %w", filePath, err))
 		}
 	}(file)
 	byteValue, err := ioutil.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("error reading file %s: %s", filePath, err.Error())
+		return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
 	}
 	return byteValue, nil
 }
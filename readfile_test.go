@@ -17,6 +17,8 @@
 package configlib
 
 import (
+	"errors"
+	"io/fs"
 	"strings"
 	"testing"
 
@@ -81,5 +83,6 @@ func TestReadFile(t *testing.T) {
 		_, err := ReadFile("./not-real-file")
 		assert.Assert(t, err != nil, "Error reading existent file.")
 		assert.Assert(t, strings.Contains(err.Error(), "open file error:"))
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist), "Error does not wrap the not exist error.")
 	})
 }
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Source is a layer of the configuration document built by a Loader.
+// Sources are merged in order, so values of a source override the ones of the sources before it.
+type Source interface {
+	// String describes the source.
+	String() string
+
+	// load returns the source document and, if known, the position of its values
+	// indexed by their JSON Pointer.
+	load(ctx context.Context, l *Loader) (map[string]interface{}, map[string]Position, error)
+}
+
+// watchedSource is implemented by the sources read from files, which a Watcher watches for changes.
+type watchedSource interface {
+	// watchPaths returns the paths of the files the source can be read from.
+	watchPaths() []string
+}
+
+type fileSource struct {
+	configName string
+	configPath string
+	optional   bool
+}
+
+// FileSource is a config file searched in configPath as configName followed by one of the
+// registered extensions (see RegisterParser), and read with the parser registered for the
+// found extension. Loading fails if the file does not exist.
+func FileSource(configName, configPath string) Source {
+	return fileSource{configName: configName, configPath: configPath}
+}
+
+// OptionalFileSource is like FileSource, but it is skipped if the file does not exist.
+// It is useful for local override files.
+func OptionalFileSource(configName, configPath string) Source {
+	return fileSource{configName: configName, configPath: configPath, optional: true}
+}
+
+func (s fileSource) String() string {
+	return fmt.Sprintf("config file %s in %s", s.configName, s.configPath)
+}
+
+func (s fileSource) load(_ context.Context, l *Loader) (map[string]interface{}, map[string]Position, error) {
+	filePath, parser, err := findConfigFile(s.configName, s.configPath, func(filePath string) bool {
+		return fileExists(l.fsys, filePath)
+	})
+	if err != nil {
+		var notFoundErr *configFileNotFoundError
+		if s.optional && errors.As(err, &notFoundErr) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("error loading config file: %w", err)
+	}
+	if l.lenientJSON && strings.EqualFold(path.Ext(filePath), ".json") {
+		parser = JSONCParser{}
+	}
+	content, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading config file: %w", err)
+	}
+	document, err := parser.Unmarshal(content)
+	if err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			syntaxErr.File = filePath
+			return nil, nil, markError(ErrDecode, fmt.Errorf("error loading config file: %w", err))
+		}
+		return nil, nil, markError(ErrDecode, fmt.Errorf("error loading config file: %s: %w", filePath, err))
+	}
+	return document, documentPositions(filePath, content, parser, document), nil
+}
+
+func (s fileSource) watchPaths() []string {
+	return configFilePaths(s.configName, s.configPath, RegisteredExtensions())
+}
+
+type mapSource map[string]interface{}
+
+// MapSource is an already built document, useful to set default values.
+func MapSource(document map[string]interface{}) Source {
+	return mapSource(document)
+}
+
+func (s mapSource) String() string {
+	return "map"
+}
+
+func (s mapSource) load(context.Context, *Loader) (map[string]interface{}, map[string]Position, error) {
+	return s, nil, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/assert"
+)
+
+func TestLayeredSources(t *testing.T) {
+	type Pool struct {
+		Size    int `koanf:"size"`
+		Timeout int `koanf:"timeout"`
+	}
+	type Database struct {
+		Host string `koanf:"host"`
+		Pool Pool   `koanf:"pool"`
+	}
+	type Configuration struct {
+		Name     string   `koanf:"name"`
+		Debug    bool     `koanf:"debug"`
+		Tags     []string `koanf:"tags"`
+		Database Database `koanf:"db"`
+	}
+
+	fsys := fstest.MapFS{
+		"config.json": &fstest.MapFile{Data: []byte(`{
+			"name": "my-service",
+			"tags": ["base"],
+			"db": {"host": "localhost", "pool": {"size": 5, "timeout": 10}}
+		}`)},
+		"config.production.yaml": &fstest.MapFile{Data: []byte("tags: [production]\ndb:\n  host: db.prod\n  pool:\n    size: 50\n")},
+		"config.local.json":      &fstest.MapFile{Data: []byte(`{"debug": true, "db": {"pool": {"timeout": 1}}}`)},
+	}
+
+	t.Run("merge sources with the later ones taking precedence", func(t *testing.T) {
+		t.Setenv("APP_DB__POOL__SIZE", "100")
+
+		config, err := Load[Configuration](context.Background(), WithFS(fsys), WithSources(
+			MapSource(map[string]interface{}{"name": "default-name", "debug": false}),
+			FileSource("config", "."),
+			FileSource("config.production", "."),
+			OptionalFileSource("config.local", "."),
+			EnvSource("APP"),
+		))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.DeepEqual(t, config, Configuration{
+			Name:     "my-service",
+			Debug:    true,
+			Tags:     []string{"production"},
+			Database: Database{Host: "db.prod", Pool: Pool{Size: 100, Timeout: 1}},
+		})
+	})
+
+	t.Run("order of the sources defines precedence", func(t *testing.T) {
+		t.Setenv("APP_DB__POOL__SIZE", "100")
+
+		config, err := Load[Configuration](
+			context.Background(),
+			WithFS(fsys),
+			WithEnvOverlay("APP"),
+			WithFile("config", "."),
+		)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Database.Pool.Size, 5)
+	})
+
+	t.Run("skip optional file if not found", func(t *testing.T) {
+		config, err := Load[Configuration](context.Background(), WithFS(fsys), WithSources(
+			FileSource("config", "."),
+			OptionalFileSource("config.missing", "."),
+		))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, config.Name, "my-service")
+	})
+
+	t.Run("throws if optional file is ambiguous", func(t *testing.T) {
+		ambiguousFS := fstest.MapFS{
+			"config.local.json": &fstest.MapFile{Data: []byte(`{}`)},
+			"config.local.yaml": &fstest.MapFile{Data: []byte(`{}`)},
+		}
+		_, err := Load[Configuration](context.Background(), WithFS(ambiguousFS), WithSources(
+			OptionalFileSource("config.local", "."),
+		))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "multiple config files found"), err.Error())
+	})
+
+	t.Run("throws if required file is not found", func(t *testing.T) {
+		_, err := Load[Configuration](context.Background(), WithFS(fsys), WithSources(
+			FileSource("config", "."),
+			FileSource("config.staging", "."),
+		))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "config file config.staging not found"), err.Error())
+	})
+
+	t.Run("validate the merged document", func(t *testing.T) {
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"db": {"properties": {"host": {"const": "db.prod"}}}
+			},
+			"required": ["debug"]
+		}`)
+		_, err := Load[Configuration](context.Background(), WithFS(fsys), WithSchema(jsonSchema), WithSources(
+			FileSource("config", "."),
+			FileSource("config.production", "."),
+			OptionalFileSource("config.local", "."),
+		))
+		assert.Equal(t, err, nil, "Error is not nil.")
+
+		_, err = Load[Configuration](context.Background(), WithFS(fsys), WithSchema(jsonSchema), WithSources(
+			FileSource("config", "."),
+			FileSource("config.production", "."),
+		))
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), err.Error())
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of field names suggested for an unknown key.
+const maxSuggestions = 3
+
+// suggestKeys returns the field names of the output type closest to the unknown key at pointer,
+// sorted by edit distance. Only names close enough to be a plausible typo are returned.
+func suggestKeys(outputType reflect.Type, pointer string) []string {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil || len(tokens) == 0 || outputType == nil {
+		return nil
+	}
+	parentType, ok := fieldType(outputType, tokens[:len(tokens)-1])
+	if !ok {
+		return nil
+	}
+	key := strings.ToLower(tokens[len(tokens)-1])
+	maxDistance := len(key)/3 + 1
+
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var suggestions []suggestion
+	for _, name := range fieldNames(parentType) {
+		if distance := editDistance(key, strings.ToLower(name)); distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: name, distance: distance})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+
+	names := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// fieldType returns the type of the value decoded from the document field at the path tokens.
+func fieldType(t reflect.Type, tokens []string) (reflect.Type, bool) {
+	for _, token := range tokens {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := structField(t, token)
+			if !ok {
+				return nil, false
+			}
+			t = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return nil, false
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// structField returns the field of t decoded from the document key name, matching it
+// case insensitively as mapstructure does.
+func structField(t reflect.Type, name string) (reflect.StructField, bool) {
+	var found reflect.StructField
+	var ok bool
+	walkStructFields(t, func(fieldName string, field reflect.StructField) {
+		if !ok && strings.EqualFold(fieldName, name) {
+			found, ok = field, true
+		}
+	})
+	return found, ok
+}
+
+// fieldNames returns the document keys decoded into the fields of the struct type t.
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	walkStructFields(t, func(fieldName string, _ reflect.StructField) {
+		names = append(names, fieldName)
+	})
+	return names
+}
+
+// walkStructFields calls fn with the exported fields of the struct type t and their key
+// in the configuration document, descending into the squashed embedded structs.
+func walkStructFields(t reflect.Type, fn func(fieldName string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("koanf"), ",")
+		if name == "-" || strings.Contains(options, "remain") {
+			continue
+		}
+		if strings.Contains(options, "squash") {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				walkStructFields(embedded, fn)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fn(name, field)
+	}
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
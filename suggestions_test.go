@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestUnknownKeySuggestions(t *testing.T) {
+	type Common struct {
+		LogLevel string `koanf:"logLevel"`
+	}
+	type Database struct {
+		Host     string `koanf:"host"`
+		Port     int    `koanf:"port"`
+		Password string `koanf:"-"`
+	}
+	type Configuration struct {
+		Common    `koanf:",squash"`
+		Name      string              `koanf:"name"`
+		Database  Database            `koanf:"database"`
+		Replicas  []Database          `koanf:"replicas"`
+		Databases map[string]Database `koanf:"databases"`
+		Timeout   int
+	}
+
+	t.Run("suggests the closest fields of GetConfigFromFile output", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.yaml", "name: a\ndatabse:\n  host: b\ndatabase:\n  hots: c\n  prot: 1\n")
+
+		var config Configuration
+		err := GetConfigFromFile("config", dir, nil, &config)
+		assert.Assert(t, errors.Is(err, ErrDecode))
+
+		byPointer := map[string]*DecodeError{}
+		collectDecodeErrors(err, byPointer)
+		assert.Equal(t, len(byPointer), 3)
+		assert.DeepEqual(t, byPointer["/databse"].Suggestions, []string{"database", "databases"})
+		assert.DeepEqual(t, byPointer["/database/hots"].Suggestions, []string{"host"})
+		assert.DeepEqual(t, byPointer["/database/prot"].Suggestions, []string{"port"})
+		assert.ErrorContains(t, err, `config.yaml:5:3: /database/hots: unknown key, did you mean "host"?`)
+	})
+
+	t.Run("suggests through squashed structs, slices, maps and untagged fields", func(t *testing.T) {
+		outputType := reflect.TypeOf(&Configuration{})
+		assert.DeepEqual(t, suggestKeys(outputType, "/loglevel"), []string{"logLevel"})
+		assert.DeepEqual(t, suggestKeys(outputType, "/timeuot"), []string{"Timeout"})
+		assert.DeepEqual(t, suggestKeys(outputType, "/replicas/0/hots"), []string{"host"})
+		assert.DeepEqual(t, suggestKeys(outputType, "/databases/main/prt"), []string{"port"})
+	})
+
+	t.Run("does not suggest unrelated or ignored fields", func(t *testing.T) {
+		outputType := reflect.TypeOf(&Configuration{})
+		assert.Equal(t, len(suggestKeys(outputType, "/unrelated")), 0)
+		assert.Equal(t, len(suggestKeys(outputType, "/database/passwrd")), 0)
+		assert.Equal(t, len(suggestKeys(reflect.TypeOf(&map[string]interface{}{}), "/a/b")), 0)
+	})
+}
+
+func collectDecodeErrors(err error, byPointer map[string]*DecodeError) {
+	switch err := err.(type) {
+	case *DecodeError:
+		byPointer[err.Pointer] = err
+	case interface{ Unwrap() []error }:
+		for _, err := range err.Unwrap() {
+			collectDecodeErrors(err, byPointer)
+		}
+	case interface{ Unwrap() error }:
+		collectDecodeErrors(err.Unwrap(), byPointer)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, editDistance("", ""), 0)
+	assert.Equal(t, editDistance("databse", "database"), 1)
+	assert.Equal(t, editDistance("kitten", "sitting"), 3)
+	assert.Equal(t, editDistance("port", ""), 4)
+}
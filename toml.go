@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TOMLParser is a koanf parser for TOML documents.
+// Integers are kept as int64 and datetimes as time.Time: local datetimes and local dates,
+// which have no offset, are interpreted in UTC. Local times are kept as strings.
+type TOMLParser struct{}
+
+// Unmarshal parses the given TOML bytes.
+func (TOMLParser) Unmarshal(b []byte) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	if err := toml.Unmarshal(b, &out); err != nil {
+		return nil, newTOMLSyntaxError(err)
+	}
+	return convertTOMLValue(out).(map[string]interface{}), nil
+}
+
+// Marshal marshals the given config map to TOML bytes.
+func (TOMLParser) Marshal(o map[string]interface{}) ([]byte, error) {
+	return toml.Marshal(o)
+}
+
+func convertTOMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertTOMLValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertTOMLValue(item)
+		}
+		return v
+	case toml.LocalDateTime:
+		return v.AsTime(time.UTC)
+	case toml.LocalDate:
+		return v.AsTime(time.UTC)
+	case toml.LocalTime:
+		return v.String()
+	default:
+		return value
+	}
+}
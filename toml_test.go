@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestTOMLParser(t *testing.T) {
+	t.Run("keeps integers and datetimes types", func(t *testing.T) {
+		out, err := TOMLParser{}.Unmarshal([]byte(`
+offset = 2023-06-01T10:30:00Z
+local = 2023-06-01T10:30:00
+date = 2023-06-01
+clock = 10:30:00
+integer = 42
+list = [1, 2]
+nested = { at = 2023-06-01 }
+`))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		expectedTime := time.Date(2023, 6, 1, 10, 30, 0, 0, time.UTC)
+		assert.Assert(t, out["offset"].(time.Time).Equal(expectedTime))
+		assert.Equal(t, out["local"], expectedTime)
+		assert.Equal(t, out["date"], time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+		assert.Equal(t, out["clock"], "10:30:00")
+		assert.Equal(t, out["integer"], int64(42))
+		assert.DeepEqual(t, out["list"], []interface{}{int64(1), int64(2)})
+		assert.Equal(t, out["nested"].(map[string]interface{})["at"], time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	t.Run("throws if document is not valid toml", func(t *testing.T) {
+		_, err := TOMLParser{}.Unmarshal([]byte(`key = `))
+		assert.Assert(t, err != nil, "Error is nil.")
+	})
+}
+
+func TestGetConfigFromTOMLFile(t *testing.T) {
+	type Server struct {
+		Host  string   `koanf:"host"`
+		Port  int64    `koanf:"port"`
+		Ratio float64  `koanf:"ratio"`
+		Tags  []string `koanf:"tags"`
+	}
+	type Configuration struct {
+		Title          string    `koanf:"title"`
+		StartedAt      time.Time `koanf:"started-at"`
+		ReleasedOn     time.Time `koanf:"released-on"`
+		MaxConnections int64     `koanf:"max-connections"`
+		Server         Server    `koanf:"server"`
+	}
+
+	configName := "test-config-toml.test"
+	configPath := "."
+
+	t.Run("read correctly toml configuration, validate with json schema and set to config structure", func(t *testing.T) {
+		var config Configuration
+		jsonSchema := readFile(t, "./config-toml.schema.test.json")
+		err := GetConfigFromFile(configName, configPath, jsonSchema, &config)
+		assert.Equal(t, err, nil, "Error is not nil.")
+
+		assert.Equal(t, config.Title, "my-service")
+		assert.Assert(t, config.StartedAt.Equal(time.Date(2023, 6, 1, 8, 30, 0, 0, time.UTC)), config.StartedAt.String())
+		assert.Equal(t, config.ReleasedOn, time.Date(2023, 5, 30, 0, 0, 0, 0, time.UTC))
+		assert.Equal(t, config.MaxConnections, int64(9007199254740993))
+		assert.DeepEqual(t, config.Server, Server{
+			Host:  "localhost",
+			Port:  3000,
+			Ratio: 0.75,
+			Tags:  []string{"a", "b"},
+		})
+	})
+
+	t.Run("throws if toml config file validation fails", func(t *testing.T) {
+		var config Configuration
+		jsonSchema := []byte(`{
+			"type": "object",
+			"properties": {
+				"max-connections": {"type": "integer", "maximum": 100}
+			}
+		}`)
+		err := GetConfigFromFile(configName, configPath, jsonSchema, &config)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "configuration not valid:"), err.Error())
+	})
+
+	t.Run("throw if output struct does not contain toml config variable", func(t *testing.T) {
+		type MyConfigStructure struct {
+			Title string `koanf:"title"`
+		}
+		var wrongConfig MyConfigStructure
+		err := GetConfigFromFile(configName, configPath, nil, &wrongConfig)
+		assert.Assert(t, err != nil, "Error is nil.")
+		assert.Assert(t, strings.Contains(err.Error(), "error unmarshalling file:"), err.Error())
+	})
+}
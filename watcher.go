@@ -0,0 +1,356 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/knadh/koanf/v2"
+)
+
+// defaultWatchDebounce is the time a Watcher waits for the file changes to settle before reloading.
+const defaultWatchDebounce = 100 * time.Millisecond
+
+// kubernetesDataDir is the symlink Kubernetes swaps atomically to update the files of a mounted
+// ConfigMap or Secret, which are symlinks to the files of the directory it points to.
+const kubernetesDataDir = "..data"
+
+// WithWatchDebounce sets the time a Watcher waits after a file change before reloading the configuration,
+// so that a burst of changes, such as an editor saving a file or Kubernetes updating a ConfigMap,
+// causes a single reload. It is 100ms by default.
+func WithWatchDebounce(debounce time.Duration) Option {
+	return func(l *Loader) {
+		l.watchDebounce = debounce
+	}
+}
+
+// WatchStatus is the status of a Watcher.
+type WatchStatus struct {
+	// LastLoaded is when the configuration was last loaded successfully.
+	LastLoaded time.Time
+	// Err is the error of the last reload, or nil if it succeeded. While it is set,
+	// the Watcher holds the last configuration loaded successfully.
+	Err error
+}
+
+// Watcher holds a configuration of type T, reloading it each time one of its files changes.
+// The configuration is loaded, validated and decoded as done by Load, and each successfully
+// loaded value is published atomically: readers always get a complete configuration.
+// If a reloaded configuration can not be loaded, or a validator rejects it, the Watcher keeps
+// the last valid one and reports the error to the OnError function and in its Status.
+// Create it with NewWatcher or Watch.
+type Watcher[T any] struct {
+	loader *Loader
+	value  atomic.Pointer[T]
+
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	stateMutex sync.Mutex
+	status     WatchStatus
+	onError    func(err error)
+	// document is the flattened document of the current configuration.
+	document      map[string]interface{}
+	subscriptions []*subscription
+	validators    []func(old, new T) error
+}
+
+// subscription is a function subscribed to the changes of the configuration subtree matched by pattern.
+type subscription struct {
+	pattern []string
+	fn      func(diff Diff)
+}
+
+// NewWatcher creates a Watcher loading the configuration configured by opts.
+// Call Start to load the configuration and start watching its files.
+func NewWatcher[T any](opts ...Option) *Watcher[T] {
+	return &Watcher[T]{loader: NewLoader(opts...)}
+}
+
+// Watch creates a Watcher loading the configuration configured by opts, and starts it.
+// The configuration is reloaded until ctx is done or the Watcher is closed.
+func Watch[T any](ctx context.Context, opts ...Option) (*Watcher[T], error) {
+	w := NewWatcher[T](opts...)
+	if err := w.Start(ctx); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start loads the configuration, failing if it can not be loaded, and starts watching the config
+// files, the merge patches and the json schema file of the loader. The files are watched on the
+// os file system, and the configuration is reloaded until ctx is done or Close is called.
+//
+// Files mounted from a Kubernetes ConfigMap or Secret are supported: they are reloaded once
+// each time Kubernetes swaps the ..data symlink of their directory.
+func (w *Watcher[T]) Start(ctx context.Context) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.done != nil {
+		return errors.New("watcher already started")
+	}
+
+	value, k, err := loadAs[T](ctx, w.loader)
+	if err != nil {
+		return err
+	}
+	w.publish(&value, k)
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching config files: %w", err)
+	}
+	paths := w.loader.watchPaths()
+	for _, dir := range watchDirs(paths) {
+		if err := fsWatcher.Add(dir); err != nil {
+			fsWatcher.Close()
+			return fmt.Errorf("error watching config files: %s: %w", dir, err)
+		}
+	}
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go w.run(ctx, fsWatcher, paths)
+	return nil
+}
+
+// Get returns the last loaded configuration, or the zero value if the Watcher has not been started.
+func (w *Watcher[T]) Get() T {
+	if value := w.value.Load(); value != nil {
+		return *value
+	}
+	var zero T
+	return zero
+}
+
+// OnError sets the function called with the error of each failed reload, and with the errors
+// occurred watching the files. It is called from the Watcher goroutine.
+func (w *Watcher[T]) OnError(fn func(err error)) {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	w.onError = fn
+}
+
+// Status returns when the configuration was last loaded successfully, and the error of the last
+// reload if it failed.
+func (w *Watcher[T]) Status() WatchStatus {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.status
+}
+
+// AddValidator adds a validator for the reloaded configurations, called with the current and the
+// reloaded configuration before the latter is published. Validators can reject configurations that
+// are valid for the json schema but unsafe to apply at runtime returning an error: the reload is
+// then reported as a validation failure, matching ErrValidation, and the current configuration is kept.
+// Validators are not called for the configuration loaded by Start.
+func (w *Watcher[T]) AddValidator(fn func(old, new T) error) {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	w.validators = append(w.validators, fn)
+}
+
+// Subscribe sets fn to be called with the changes of each reload affecting the configuration subtree
+// matched by pattern. The pattern is made of the object keys separated by dots, where a `*` matches
+// any key: `db` and `db.*` match all the changes under db, while `servers.*.port` matches the port
+// of any server. An empty pattern matches all the changes. fn is called from the Watcher goroutine,
+// after the new configuration is published, and only with the matching changes.
+// The returned function cancels the subscription.
+func (w *Watcher[T]) Subscribe(pattern string, fn func(diff Diff)) (unsubscribe func()) {
+	s := &subscription{pattern: splitMergePath(pattern), fn: fn}
+	if len(s.pattern) > 0 && s.pattern[len(s.pattern)-1] == "*" {
+		s.pattern = s.pattern[:len(s.pattern)-1]
+	}
+
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	w.subscriptions = append(w.subscriptions, s)
+	return func() {
+		w.stateMutex.Lock()
+		defer w.stateMutex.Unlock()
+		for i, candidate := range w.subscriptions {
+			if candidate == s {
+				w.subscriptions = append(w.subscriptions[:i:i], w.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Close stops watching the configuration files. Get keeps returning the last loaded configuration.
+func (w *Watcher[T]) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.done == nil {
+		return nil
+	}
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+func (w *Watcher[T]) run(ctx context.Context, fsWatcher *fsnotify.Watcher, paths []string) {
+	defer close(w.done)
+	defer fsWatcher.Close()
+
+	watched := map[string]bool{}
+	for _, filePath := range paths {
+		watched[filepath.Clean(filePath)] = true
+	}
+	dirs := map[string]bool{}
+	for _, dir := range watchDirs(paths) {
+		dirs[filepath.Clean(dir)] = true
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if isConfigChange(event, watched, dirs) {
+				debounce = time.After(w.loader.watchDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			w.reload(ctx)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			w.reportError(fmt.Errorf("error watching config files: %w", err))
+		}
+	}
+}
+
+// isConfigChange reports whether event changes one of the watched files, either directly or
+// swapping the Kubernetes ..data symlink of one of the watched directories.
+func isConfigChange(event fsnotify.Event, watched, dirs map[string]bool) bool {
+	name := filepath.Clean(event.Name)
+	if filepath.Base(name) == kubernetesDataDir {
+		return dirs[filepath.Dir(name)] && event.Has(fsnotify.Create)
+	}
+	return watched[name] && event.Op != fsnotify.Chmod
+}
+
+// reload loads the configuration, publishing it if it is loaded successfully and keeping
+// the current one otherwise. A reload interrupted by the Watcher being closed is not reported.
+func (w *Watcher[T]) reload(ctx context.Context) {
+	value, k, err := loadAs[T](ctx, w.loader)
+	if err == nil {
+		err = w.validate(w.Get(), value)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		w.stateMutex.Lock()
+		w.status.Err = err
+		w.stateMutex.Unlock()
+		w.reportError(err)
+		return
+	}
+
+	diff, subscriptions := w.publish(&value, k)
+	for _, s := range subscriptions {
+		if filtered := diff.filter(s.pattern); !filtered.IsEmpty() {
+			s.fn(filtered)
+		}
+	}
+}
+
+// validate calls the validators with the current and the reloaded configuration, returning
+// the joined errors of the validators rejecting it.
+func (w *Watcher[T]) validate(old, new T) error {
+	w.stateMutex.Lock()
+	validators := append([]func(old, new T) error(nil), w.validators...)
+	w.stateMutex.Unlock()
+
+	var errs []error
+	for _, validator := range validators {
+		if err := validator(old, new); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return markError(ErrValidation, fmt.Errorf("reload rejected: %w", errors.Join(errs...)))
+	}
+	return nil
+}
+
+// publish makes value the current configuration, returning its changes and the subscriptions to notify.
+func (w *Watcher[T]) publish(value *T, k *koanf.Koanf) (Diff, []*subscription) {
+	document := k.All()
+
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	diff := diffDocuments(w.document, document)
+	w.value.Store(value)
+	w.document = document
+	w.status = WatchStatus{LastLoaded: time.Now()}
+	return diff, append([]*subscription(nil), w.subscriptions...)
+}
+
+func (w *Watcher[T]) reportError(err error) {
+	w.stateMutex.Lock()
+	onError := w.onError
+	w.stateMutex.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// watchPaths returns the paths of the files the configuration is read from.
+func (l *Loader) watchPaths() []string {
+	var paths []string
+	for _, source := range l.sources {
+		if watched, ok := source.(watchedSource); ok {
+			paths = append(paths, watched.watchPaths()...)
+		}
+	}
+	if l.schemaFile != "" {
+		paths = append(paths, l.schemaFile)
+	}
+	return paths
+}
+
+// watchDirs returns the directories holding paths. Directories are watched instead of
+// the files, so that files created or replaced after the watch started are detected.
+func watchDirs(paths []string) []string {
+	unique := map[string]bool{}
+	for _, filePath := range paths {
+		unique[filepath.Dir(filePath)] = true
+	}
+	dirs := make([]string, 0, len(unique))
+	for dir := range unique {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2019 Mia srl
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+type watchedConfig struct {
+	Name string `koanf:"name"`
+	Port int    `koanf:"port"`
+}
+
+func TestWatcher(t *testing.T) {
+	t.Run("reloads the configuration when the config file changes", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		w, err := Watch[watchedConfig](context.Background(), WithFile("config", dir))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		defer w.Close()
+		assert.Equal(t, w.Get(), watchedConfig{Name: "my-service", Port: 3000})
+
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 4000}`)
+		waitFor(t, func() bool { return w.Get().Port == 4000 })
+	})
+
+	t.Run("reloads the configuration when a file is replaced by a rename", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.yaml", "name: my-service\nport: 3000\n")
+
+		w, err := Watch[watchedConfig](context.Background(), WithFile("config", dir))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		defer w.Close()
+
+		writeTestFile(t, dir, "config.yaml.tmp", "name: renamed\nport: 3000\n")
+		assert.Equal(t, os.Rename(filepath.Join(dir, "config.yaml.tmp"), filepath.Join(dir, "config.yaml")), nil)
+		waitFor(t, func() bool { return w.Get().Name == "renamed" })
+	})
+
+	t.Run("reloads the configuration when the schema file changes", func(t *testing.T) {
+		dir := t.TempDir()
+		schemaDir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+		writeTestFile(t, schemaDir, "schema.json", `{"properties": {"port": {"maximum": 5000}}}`)
+
+		w, err := Watch[watchedConfig](context.Background(),
+			WithFile("config", dir),
+			WithSchemaFile(filepath.Join(schemaDir, "schema.json")),
+		)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		defer w.Close()
+
+		writeTestFile(t, dir, "config.json", `{"name": "reloaded", "port": 6000}`)
+		waitFor(t, func() bool { return w.Status().Err != nil })
+		assert.Assert(t, errors.Is(w.Status().Err, ErrValidation), "Error is not a validation error: %v", w.Status().Err)
+		assert.Equal(t, w.Get(), watchedConfig{Name: "my-service", Port: 3000})
+
+		writeTestFile(t, schemaDir, "schema.json", `{"properties": {"port": {"maximum": 8000}}}`)
+		waitFor(t, func() bool { return w.Get().Port == 6000 })
+		assert.Equal(t, w.Get().Name, "reloaded")
+	})
+
+	t.Run("reloads once for a burst of changes", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		var loads atomic.Int64
+		w, err := Watch[watchedConfig](context.Background(),
+			WithFile("config", dir),
+			WithSources(loadCounter{loads: &loads}),
+			WithWatchDebounce(50*time.Millisecond),
+		)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		defer w.Close()
+
+		for port := 3001; port <= 3010; port++ {
+			writeTestFile(t, dir, "config.json", fmt.Sprintf(`{"name": "my-service", "port": %d}`, port))
+		}
+		waitFor(t, func() bool { return w.Get().Port == 3010 })
+		time.Sleep(150 * time.Millisecond)
+		assert.Equal(t, loads.Load(), int64(2), "The configuration is not loaded once at start and once on reload.")
+	})
+
+	t.Run("reloads once when Kubernetes swaps the ConfigMap data", func(t *testing.T) {
+		dir := t.TempDir()
+		writeKubernetesData(t, dir, "..2024_01_01_00_00_00.1", `{"name": "my-service", "port": 3000}`)
+		assert.Equal(t, os.Symlink("..2024_01_01_00_00_00.1", filepath.Join(dir, "..data")), nil)
+		assert.Equal(t, os.Symlink(filepath.Join("..data", "config.json"), filepath.Join(dir, "config.json")), nil)
+
+		var loads atomic.Int64
+		w, err := Watch[watchedConfig](context.Background(),
+			WithFile("config", dir),
+			WithSources(loadCounter{loads: &loads}),
+			WithWatchDebounce(50*time.Millisecond),
+		)
+		assert.Equal(t, err, nil, "Error is not nil.")
+		defer w.Close()
+		assert.Equal(t, w.Get().Port, 3000)
+
+		// the same steps of the Kubernetes atomic writer
+		writeKubernetesData(t, dir, "..2024_01_01_00_01_00.2", `{"name": "my-service", "port": 4000}`)
+		assert.Equal(t, os.Symlink("..2024_01_01_00_01_00.2", filepath.Join(dir, "..data_tmp")), nil)
+		assert.Equal(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")), nil)
+		assert.Equal(t, os.RemoveAll(filepath.Join(dir, "..2024_01_01_00_00_00.1")), nil)
+
+		waitFor(t, func() bool { return w.Get().Port == 4000 })
+		time.Sleep(150 * time.Millisecond)
+		assert.Equal(t, loads.Load(), int64(2), "The configuration is not loaded once at start and once on reload.")
+	})
+
+	t.Run("keeps the last valid configuration when a reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		w := NewWatcher[watchedConfig](
+			WithFile("config", dir),
+			WithSchema([]byte(`{"properties": {"port": {"maximum": 5000}}}`)),
+			WithWatchDebounce(20*time.Millisecond),
+		)
+		reloadErrors := make(chan error, 10)
+		w.OnError(func(err error) { reloadErrors <- err })
+		assert.Equal(t, w.Status(), WatchStatus{})
+		assert.Equal(t, w.Start(context.Background()), nil)
+		defer w.Close()
+		loaded := w.Status().LastLoaded
+		assert.Assert(t, !loaded.IsZero())
+
+		for _, test := range []struct {
+			content  string
+			sentinel error
+		}{
+			{content: `{"name": "my-service",`, sentinel: ErrDecode},
+			{content: `{"name": "my-service", "port": 6000}`, sentinel: ErrValidation},
+			{content: `{"name": "my-service", "unknown": true}`, sentinel: ErrDecode},
+		} {
+			writeTestFile(t, dir, "config.json", test.content)
+			select {
+			case err := <-reloadErrors:
+				assert.Assert(t, errors.Is(err, test.sentinel), err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("reload error not reported")
+			}
+			assert.Equal(t, w.Get(), watchedConfig{Name: "my-service", Port: 3000})
+			status := w.Status()
+			assert.Assert(t, errors.Is(status.Err, test.sentinel), status.Err)
+			assert.Equal(t, status.LastLoaded, loaded)
+		}
+
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 4000}`)
+		waitFor(t, func() bool { return w.Get().Port == 4000 })
+		status := w.Status()
+		assert.Equal(t, status.Err, nil)
+		assert.Assert(t, status.LastLoaded.After(loaded))
+	})
+
+	t.Run("does not report reloads interrupted by Close", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		w := NewWatcher[watchedConfig](WithFile("config", dir))
+		reloadErrors := make(chan error, 10)
+		w.OnError(func(err error) { reloadErrors <- err })
+		assert.Equal(t, w.Start(context.Background()), nil)
+		assert.Equal(t, w.Close(), nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w.reload(ctx)
+		assert.Equal(t, w.Status().Err, nil)
+		assert.Equal(t, len(reloadErrors), 0)
+		assert.Equal(t, w.Get(), watchedConfig{Name: "my-service", Port: 3000})
+	})
+
+	t.Run("notifies the subscribers of the changed subtrees", func(t *testing.T) {
+		type Database struct {
+			Host string `koanf:"host"`
+			Port int    `koanf:"port"`
+		}
+		type Configuration struct {
+			Name string   `koanf:"name"`
+			DB   Database `koanf:"db"`
+		}
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "db": {"host": "localhost", "port": 5432}}`)
+
+		w := NewWatcher[Configuration](WithFile("config", dir), WithWatchDebounce(20*time.Millisecond))
+		type notification struct {
+			diff Diff
+			// host is the one of the configuration published when the subscriber is notified.
+			host string
+		}
+		dbDiffs := make(chan notification, 10)
+		allDiffs := make(chan Diff, 10)
+		w.Subscribe("db.*", func(diff Diff) {
+			dbDiffs <- notification{diff: diff, host: w.Get().DB.Host}
+		})
+		unsubscribe := w.Subscribe("", func(diff Diff) { allDiffs <- diff })
+		assert.Equal(t, w.Start(context.Background()), nil)
+		defer w.Close()
+
+		writeTestFile(t, dir, "config.json", `{"name": "renamed", "db": {"host": "db.local", "port": 5432}}`)
+		select {
+		case notified := <-dbDiffs:
+			assert.DeepEqual(t, notified.diff, Diff{Changed: []Change{{Path: "db.host", Old: "localhost", New: "db.local"}}})
+			assert.Equal(t, notified.host, "db.local")
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscriber not notified")
+		}
+		assert.DeepEqual(t, <-allDiffs, Diff{Changed: []Change{
+			{Path: "db.host", Old: "localhost", New: "db.local"},
+			{Path: "name", Old: "my-service", New: "renamed"},
+		}})
+
+		unsubscribe()
+		writeTestFile(t, dir, "config.json", `{"name": "renamed again", "db": {"host": "db.local", "port": 5432}}`)
+		waitFor(t, func() bool { return w.Get().Name == "renamed again" })
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, len(dbDiffs), 0)
+		assert.Equal(t, len(allDiffs), 0)
+	})
+
+	t.Run("keeps the configuration rejected by a validator", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		w := NewWatcher[watchedConfig](WithFile("config", dir), WithWatchDebounce(20*time.Millisecond))
+		errPortChange := errors.New("port can not change at runtime")
+		w.AddValidator(func(old, new watchedConfig) error {
+			if old.Port != new.Port {
+				return errPortChange
+			}
+			return nil
+		})
+		w.AddValidator(func(old, new watchedConfig) error {
+			if new.Name == "" {
+				return errors.New("name is required")
+			}
+			return nil
+		})
+		reloadErrors := make(chan error, 10)
+		w.OnError(func(err error) { reloadErrors <- err })
+		subscriberDiffs := make(chan Diff, 10)
+		w.Subscribe("", func(diff Diff) { subscriberDiffs <- diff })
+		assert.Equal(t, w.Start(context.Background()), nil)
+		defer w.Close()
+
+		writeTestFile(t, dir, "config.json", `{"name": "", "port": 4000}`)
+		select {
+		case err := <-reloadErrors:
+			assert.Assert(t, errors.Is(err, ErrValidation), err)
+			assert.Assert(t, errors.Is(err, errPortChange), err)
+			assert.Error(t, err, "reload rejected: port can not change at runtime\nname is required")
+		case <-time.After(5 * time.Second):
+			t.Fatal("rejection not reported")
+		}
+		assert.Equal(t, w.Get(), watchedConfig{Name: "my-service", Port: 3000})
+		assert.Assert(t, errors.Is(w.Status().Err, ErrValidation))
+		assert.Equal(t, len(subscriberDiffs), 0)
+
+		writeTestFile(t, dir, "config.json", `{"name": "renamed", "port": 3000}`)
+		waitFor(t, func() bool { return w.Get().Name == "renamed" })
+		assert.Equal(t, w.Status().Err, nil)
+	})
+
+	t.Run("stops reloading when closed", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 3000}`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w, err := Watch[watchedConfig](ctx, WithFile("config", dir))
+		assert.Equal(t, err, nil, "Error is not nil.")
+		assert.Equal(t, w.Close(), nil)
+		assert.Equal(t, w.Close(), nil)
+
+		writeTestFile(t, dir, "config.json", `{"name": "my-service", "port": 4000}`)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, w.Get().Port, 3000)
+	})
+
+	t.Run("fails to start if the configuration can not be loaded", func(t *testing.T) {
+		w := NewWatcher[watchedConfig](WithFile("config", t.TempDir()))
+		err := w.Start(context.Background())
+		assert.Assert(t, errors.Is(err, ErrConfigNotFound), err)
+		assert.Equal(t, w.Get(), watchedConfig{})
+		assert.Equal(t, w.Close(), nil)
+	})
+}
+
+// loadCounter is a source counting how many times the configuration is loaded.
+type loadCounter struct {
+	loads *atomic.Int64
+}
+
+func (loadCounter) String() string {
+	return "load counter"
+}
+
+func (c loadCounter) load(context.Context, *Loader) (map[string]interface{}, map[string]Position, error) {
+	c.loads.Add(1)
+	return map[string]interface{}{}, nil, nil
+}
+
+func writeKubernetesData(t *testing.T, dir, dataDir, content string) {
+	t.Helper()
+	assert.Equal(t, os.Mkdir(filepath.Join(dir, dataDir), 0700), nil)
+	writeTestFile(t, filepath.Join(dir, dataDir), "config.json", content)
+}
+
+// waitFor waits until condition is true, failing the test after a timeout.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not satisfied before the timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}